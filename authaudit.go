@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Failed API/admin key checks since startup, exported as pinger_auth_failures_total
+var authFailures atomic.Int64
+
+// nil when AUTH_BAN_THRESHOLD is unset or 0
+var authBans *authBanList
+
+// authBanList bans clients with too many failed key checks (AUTH_BAN_THRESHOLD within
+// AUTH_BAN_WINDOW) for AUTH_BAN_DURATION
+type authBanList struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+	clients   map[string]*authFailureWindow
+}
+
+type authFailureWindow struct {
+	start       time.Time
+	count       int
+	bannedUntil time.Time
+}
+
+func newAuthBanList(threshold int, window, duration time.Duration) *authBanList {
+	return &authBanList{threshold: threshold, window: window, duration: duration, clients: make(map[string]*authFailureWindow)}
+}
+
+// checkKey compares the request's key with want and logs a failed attempt
+func checkKey(r *http.Request, want string) bool {
+	got := r.URL.Query().Get("key")
+	if got == want {
+		return true
+	}
+	reason := "bad key"
+	if got == "" {
+		reason = "missing key"
+	}
+	recordAuthFailure(r, reason)
+	return false
+}
+
+// recordAuthFailure logs a failed key check with the client address, counts it and may ban the client.
+// The key itself is never logged.
+func recordAuthFailure(r *http.Request, reason string) {
+	client := clientIP(r)
+	authFailures.Add(1)
+	log.Printf("AUTH FAILURE client=%s url=%q reason=%q", client, redactURL(r.URL), reason)
+	if authBans != nil && authBans.fail(client) {
+		log.Printf("AUTH BAN client=%s for %s after %d failures", client, authBans.duration, authBans.threshold)
+	}
+}
+
+// fail counts a failure of client and reports whether that got it banned
+func (b *authBanList) fail(client string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	w := b.clients[client]
+	if w == nil || (now.Sub(w.start) >= b.window && now.After(w.bannedUntil)) {
+		w = &authFailureWindow{start: now}
+		b.clients[client] = w
+	}
+	w.count++
+	if w.count >= b.threshold {
+		// Counting starts over, so failures after the ban can earn another one
+		*w = authFailureWindow{start: now, bannedUntil: now.Add(b.duration)}
+		return true
+	}
+	return false
+}
+
+// banned returns how long client stays banned, 0 if it isn't
+func (b *authBanList) banned(client string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if w := b.clients[client]; w != nil {
+		if left := time.Until(w.bannedUntil); left > 0 {
+			return left
+		}
+	}
+	return 0
+}
+
+// cleanupLoop drops clients whose window and ban have passed
+func (b *authBanList) cleanupLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.cleanup()
+	}
+}
+
+func (b *authBanList) cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for client, w := range b.clients {
+		if now.Sub(w.start) >= b.window && now.After(w.bannedUntil) {
+			delete(b.clients, client)
+		}
+	}
+}
+
+// rejectBanned answers banned clients with 403 before any handler runs
+func rejectBanned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Probes don't take a key, a ban needn't stop them
+		if authBans == nil || r.URL.Path == "/healthz" || r.URL.Path == "/ready" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if left := authBans.banned(clientIP(r)); left > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+			writeError(w, http.StatusForbidden, "Too many failed auth attempts, try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendsResult is the service-level verdict of a backends check
+type BackendsResult struct {
+	Healthy    int               `json:"healthy"`
+	Total      int               `json:"total"`
+	Fraction   float64           `json:"fraction"`
+	MinHealthy int               `json:"min_healthy"`
+	Backends   map[string]any    `json:"backends"`
+	Service    *ServiceDiscovery `json:"service,omitempty"` // SRV records behind the backends, with backends=srv or service_dns
+}
+
+// ServiceDiscovery is what the SRV query of a backends check found, with the share of
+// traffic each instance would get from clients following priority and weight (RFC 2782)
+type ServiceDiscovery struct {
+	Name    string          `json:"name"`
+	Records []ServiceRecord `json:"records"`
+	// Share of traffic that would reach a healthy instance: clients use the lowest
+	// priority with a healthy instance and pick by weight within it
+	TrafficHealthy  float64 `json:"traffic_healthy"`
+	ServingPriority *int    `json:"serving_priority,omitempty"` // That priority, omitted when no instance is healthy
+}
+
+// ServiceRecord is one SRV record and the addresses of its target
+type ServiceRecord struct {
+	Backend   string   `json:"backend"` // Key in backends
+	Target    string   `json:"target"`
+	Port      uint16   `json:"port"`
+	Priority  uint16   `json:"priority"`
+	Weight    uint16   `json:"weight"`
+	Share     float64  `json:"share"` // Expected share of traffic while all instances are up, 0 for backup priorities
+	Addresses []string `json:"addresses"`
+	Error     string   `json:"error,omitempty"` // The target doesn't resolve
+}
+
+// resolveBackends lists the addresses (backends=dns) or SRV targets (backends=srv, service_dns) behind host.
+// SRV targets get their port attached when the method takes one.
+func resolveBackends(ctx context.Context, query url.Values, info methodInfo) ([]string, *ServiceDiscovery, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultCheckTimeout)
+	defer cancel()
+	host := strings.TrimSuffix(query.Get("host"), ".")
+
+	mode := query.Get("backends")
+	if query.Has("service_dns") {
+		if mode != "" && mode != "srv" {
+			return nil, nil, paramErrorf("service_dns is an SRV name, it can't be combined with backends=%s", mode)
+		}
+		mode = "srv"
+	}
+
+	var backends []string
+	var discovery *ServiceDiscovery
+	switch mode {
+	case "dns":
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, nil, dnsError(err)
+		}
+		for _, addr := range addrs {
+			backends = append(backends, addr.IP.String())
+		}
+	case "srv":
+		name := host
+		if service := strings.Trim(query.Get("service"), "."); service != "" {
+			name = service + "." + host
+		}
+		if query.Has("service_dns") {
+			name = strings.TrimSuffix(query.Get("service_dns"), ".")
+		}
+		_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, nil, dnsError(err)
+		}
+		discovery = &ServiceDiscovery{Name: name, Records: make([]ServiceRecord, len(srvs))}
+		for i, srv := range srvs {
+			target := strings.TrimSuffix(srv.Target, ".")
+			backend := target
+			if info.hasParam("port") {
+				backend = net.JoinHostPort(target, strconv.Itoa(int(srv.Port)))
+			}
+			backends = append(backends, backend)
+			discovery.Records[i] = ServiceRecord{Backend: backend, Target: target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight}
+		}
+		if len(srvs) <= maxCIDRHosts {
+			discovery.resolveTargets(ctx)
+			discovery.setShares()
+		}
+	default:
+		return nil, nil, paramErrorf("backends must be dns or srv")
+	}
+
+	if len(backends) > maxCIDRHosts {
+		return nil, nil, paramErrorf("%s has %d backends, max %d", host, len(backends), maxCIDRHosts)
+	}
+	return backends, discovery, nil
+}
+
+// resolveTargets looks up the addresses of every SRV target, in parallel
+func (d *ServiceDiscovery) resolveTargets(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range d.Records {
+		wg.Add(1)
+		go func(rec *ServiceRecord) {
+			defer wg.Done()
+			rec.Addresses = []string{}
+			addrs, err := net.DefaultResolver.LookupIPAddr(ctx, rec.Target)
+			if err != nil {
+				rec.Error = dnsError(err).Error()
+				return
+			}
+			for _, addr := range addrs {
+				rec.Addresses = append(rec.Addresses, addr.IP.String())
+			}
+		}(&d.Records[i])
+	}
+	wg.Wait()
+}
+
+// setShares gives the records of the lowest priority their share of traffic by weight
+func (d *ServiceDiscovery) setShares() {
+	if len(d.Records) == 0 {
+		return
+	}
+	lowest := d.Records[0].Priority
+	for _, rec := range d.Records {
+		lowest = min(lowest, rec.Priority)
+	}
+	shares := srvShares(d.Records, lowest)
+	for i := range d.Records {
+		d.Records[i].Share = shares[i]
+	}
+}
+
+// setTrafficHealthy finds the priority clients would be served from and how much of
+// the traffic sent there reaches a healthy instance
+func (d *ServiceDiscovery) setTrafficHealthy(up map[string]bool) {
+	var serving *int
+	for _, rec := range d.Records {
+		if up[rec.Backend] && (serving == nil || int(rec.Priority) < *serving) {
+			p := int(rec.Priority)
+			serving = &p
+		}
+	}
+	d.ServingPriority = serving
+	if serving == nil {
+		return
+	}
+	var healthy float64
+	for i, share := range srvShares(d.Records, uint16(*serving)) {
+		if up[d.Records[i].Backend] {
+			healthy += share
+		}
+	}
+	d.TrafficHealthy = math.Round(healthy*1000) / 1000
+}
+
+// srvShares splits traffic between the records of one priority by weight; when all their
+// weights are 0 they share it evenly. Records of other priorities get 0.
+func srvShares(records []ServiceRecord, priority uint16) []float64 {
+	shares := make([]float64, len(records))
+	var total float64
+	var count int
+	for _, rec := range records {
+		if rec.Priority == priority {
+			total += float64(rec.Weight)
+			count++
+		}
+	}
+	for i, rec := range records {
+		if rec.Priority != priority {
+			continue
+		}
+		if total > 0 {
+			shares[i] = math.Round(float64(rec.Weight)/total*1000) / 1000
+		} else {
+			shares[i] = math.Round(1/float64(count)*1000) / 1000
+		}
+	}
+	return shares
+}
+
+// minHealthy reads min_healthy as a count ("2") or a share of total ("50%"), default 1
+func minHealthy(s string, total int) (int, error) {
+	if s == "" {
+		return 1, nil
+	}
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		n, err := strconv.ParseFloat(pct, 64)
+		if err != nil || n < 0 || n > 100 {
+			return 0, paramErrorf("min_healthy percentage must be between 0%% and 100%%")
+		}
+		// Round up, 50% of 3 backends needs 2
+		need := int(n * float64(total) / 100)
+		if float64(need)*100 < n*float64(total) {
+			need++
+		}
+		return need, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, paramErrorf("min_healthy must be a count or a percentage like 50%%")
+	}
+	return n, nil
+}
+
+// handleBackends runs the check against every backend behind host and answers
+// with one response that is up when at least min_healthy backends are
+func handleBackends(w http.ResponseWriter, r *http.Request, query url.Values, version string) {
+	if query.Get("host") == "" && query.Get("service_dns") == "" {
+		writeError(w, http.StatusBadRequest, "host required")
+		return
+	}
+	method, info := resolveMethod(query.Get("method"))
+
+	backends, discovery, err := resolveBackends(r.Context(), query, info)
+	if err != nil {
+		status := http.StatusBadGateway
+		var pe paramError
+		if errors.As(err, &pe) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	need, err := minHealthy(query.Get("min_healthy"), len(backends))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	jobs, err := hostJobs(query, backends, version, clientIP(r), "backends", "service_dns")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	loc, err := checkParams{Query: query}.location()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	precision, err := checkParams{Query: query}.precision()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start := time.Now()
+	res := BackendsResult{Total: len(jobs), MinHealthy: need, Backends: make(map[string]any, len(jobs)), Service: discovery}
+	up := make(map[string]bool, len(jobs))
+	for i, resp := range runJobs(w, r, jobs) {
+		if resp.Up {
+			res.Healthy++
+		}
+		up[jobs[i].params.Host] = resp.Up
+		res.Backends[jobs[i].params.Host] = versioned(resp, version)
+	}
+	if discovery != nil {
+		discovery.setTrafficHealthy(up)
+	}
+	if res.Total > 0 {
+		res.Fraction = math.Round(float64(res.Healthy)/float64(res.Total)*1000) / 1000
+	}
+
+	host := query.Get("host")
+	if host == "" {
+		host = query.Get("service_dns")
+	}
+	resp := Response{Host: host, Type: method, Result: res, Up: res.Healthy >= need, CorrelationID: checkParams{Query: query}.correlationID(), checkedAt: start, precision: precision}
+	stampResponse(&resp, loc)
+	if !resp.Up {
+		resp.Error = fmt.Sprintf("%d of %d backends healthy, need %d", res.Healthy, res.Total, need)
+	}
+	writeJSON(w, r, shapeResponse(resp, version, query.Get("fields")))
+}
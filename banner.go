@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBannerBytes = 256
+	maxBannerBytes     = 4096
+	defaultBannerWait  = 2 * time.Second
+)
+
+// BannerResult is the greeting a service sent right after the connect
+type BannerResult struct {
+	ConnectMs float64 `json:"connect_ms"`
+	Banner    string  `json:"banner"`            // Non-printable bytes escaped like in Go strings, e.g. \r\n
+	Matched   *bool   `json:"matched,omitempty"` // With expect
+}
+
+// Up is false when expect was given and the banner doesn't contain it
+func (r BannerResult) Up() bool { return r.Matched == nil || *r.Matched }
+
+// bannerChecker connects to host:port and reads what the service says first (SSH, FTP, SMTP, ...)
+type bannerChecker struct{}
+
+type bannerOptions struct {
+	tcpOptions
+	MaxBytes int
+	Wait     time.Duration // How long to wait for the banner once connected
+	Expect   string
+}
+
+func (bannerChecker) Validate(p checkParams) error {
+	_, err := parseBannerOptions(p)
+	return err
+}
+
+func parseBannerOptions(p checkParams) (bannerOptions, error) {
+	opts := bannerOptions{MaxBytes: defaultBannerBytes, Expect: p.Get("expect")}
+	if _, err := tcpAddress(p.Host, p.Get("port")); err != nil {
+		return opts, paramError{err.Error()}
+	}
+	if s := p.Get("max_bytes"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxBannerBytes {
+			return opts, paramErrorf("max_bytes must be between 1 and %d", maxBannerBytes)
+		}
+		opts.MaxBytes = n
+	}
+
+	var err error
+	if opts.Dialer, err = p.Dialer(); err != nil {
+		return opts, err
+	}
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, err
+	}
+	if opts.Wait, err = p.durationParam("wait", defaultBannerWait); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+func (bannerChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseBannerOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	addr, err := tcpAddress(p.Host, p.Get("port"))
+	if err != nil {
+		return 0, err
+	}
+	return checkBanner(ctx, addr, opts)
+}
+
+// checkBanner reads until the first line ends, MaxBytes arrived, the service closes the
+// connection or Wait runs out. A service that stays silent isn't an error, the banner is empty then.
+func checkBanner(ctx context.Context, addr string, opts bannerOptions) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = directDialer
+	}
+	start := time.Now()
+	conn, err := dialTimeout(ctx, dialer, "tcp", addr, opts.ConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	res := BannerResult{ConnectMs: durationMs(time.Since(start))}
+
+	deadline := time.Now().Add(opts.Wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, opts.MaxBytes)
+	n := 0
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		n += m
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			n = i + 1
+			break
+		}
+		if err == nil {
+			continue
+		}
+		// Silence until the deadline or a closed connection just ends the banner
+		var ne net.Error
+		if n > 0 || errors.Is(err, io.EOF) || (errors.As(err, &ne) && ne.Timeout()) {
+			break
+		}
+		return 0, fmt.Errorf("read failed: %w", err)
+	}
+	banner := buf[:n]
+
+	quoted := strconv.Quote(string(banner))
+	res.Banner = quoted[1 : len(quoted)-1]
+	if opts.Expect != "" {
+		matched := strings.Contains(string(banner), opts.Expect)
+		res.Matched = &matched
+	}
+	return res, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Max entries in one /batch request (MAX_BATCH_SIZE)
+var maxBatchSize = 50
+
+// Cap on the /batch request body
+const maxBatchBody = 1 << 20
+
+// batchJob is a validated batch entry ready to run
+type batchJob struct {
+	method  string
+	info    methodInfo
+	params  checkParams
+	fields  string // Response field filter, see selectFields
+	version string // Response schema version, see versioned
+}
+
+// handleBatch runs several checks from a JSON array body, e.g.
+// [{"host": "google.com"}, {"host": "example.com", "method": "https"}].
+// Every key of an entry is treated like the query param of the same name.
+func handleBatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !authorized(r) {
+		writeError(w, http.StatusForbidden, "Auth failed")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "POST a JSON array of checks")
+		return
+	}
+
+	version, ok := requestAPIVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var entries []map[string]any
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBody)).Decode(&entries); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid batch: expected a JSON array of objects")
+		return
+	}
+	if len(entries) == 0 {
+		writeError(w, http.StatusBadRequest, "empty batch")
+		return
+	}
+	if len(entries) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("batch too large: %d entries, max %d", len(entries), maxBatchSize))
+		return
+	}
+
+	// Validate everything before running anything
+	jobs := make([]batchJob, len(entries))
+	for i, entry := range entries {
+		for _, name := range []string{"tz", "precision"} {
+			if _, ok := entry[name]; !ok && r.URL.Query().Get(name) != "" {
+				entry[name] = r.URL.Query().Get(name) // Batch-wide default, validated with the entry
+			}
+		}
+		job, err := newBatchJob(entry)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("entry %d: %v", i, err))
+			return
+		}
+		if err := methodEnabled(job.method); err != nil {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("entry %d: %v", i, err))
+			return
+		}
+		if job.fields == "" {
+			job.fields = r.URL.Query().Get("fields") // Batch-wide default
+		}
+		job.version = version
+		job.params.Client = clientIP(r)
+		jobs[i] = job
+	}
+
+	var longest time.Duration
+	for _, job := range jobs {
+		longest = max(longest, checkDuration(job.info, job.params))
+	}
+	extendWriteDeadline(w, longest) // Entries run in parallel, so the longest one counts
+
+	if r.URL.Query().Get("stream") == "true" {
+		streamBatch(w, r, jobs)
+		return
+	}
+
+	results := make([]any, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job batchJob) {
+			defer wg.Done()
+			results[i] = shapeResponse(job.run(r.Context()), job.version, job.fields)
+		}(i, job)
+	}
+	wg.Wait()
+
+	writeJSON(w, r, results)
+}
+
+func newBatchJob(entry map[string]any) (batchJob, error) {
+	values := url.Values{}
+	for k, v := range entry {
+		switch v := v.(type) {
+		case string:
+			values.Set(k, v)
+		case float64, bool:
+			values.Set(k, fmt.Sprint(v))
+		default:
+			return batchJob{}, fmt.Errorf("%s must be a string, number or boolean", k)
+		}
+	}
+
+	if name := values.Get("method"); name != "" {
+		if _, ok := lookupMethod(name); !ok {
+			return batchJob{}, fmt.Errorf("unknown method %q", name)
+		}
+	}
+
+	method, info := resolveMethod(values.Get("method"))
+	host := values.Get("host")
+	if host == "" && info.hasParam("host") {
+		return batchJob{}, fmt.Errorf("host required")
+	}
+	params := checkParams{Host: host, Query: values}
+	if err := validateCheck(info, params); err != nil {
+		return batchJob{}, err
+	}
+	return batchJob{method: method, info: info, params: params, fields: values.Get("fields")}, nil
+}
+
+// run waits for a global slot (a batch shouldn't fail just because it's larger
+// than the pool) but fails fast on a saturated host, like single requests do
+func (j batchJob) run(ctx context.Context) Response {
+	failed := func(msg string) Response {
+		return Response{Host: j.params.Host, Type: j.method, Result: 0, Error: msg, CorrelationID: j.params.correlationID()}
+	}
+
+	if err := concurrencyLimit.acquire(ctx); err != nil {
+		return failed("request cancelled")
+	}
+	defer concurrencyLimit.release()
+
+	if perHostLimit != nil && j.params.Host != "" {
+		release, ok := perHostLimit.acquire(j.params.Host)
+		if !ok {
+			return failed("Too many concurrent checks for this host, try again later")
+		}
+		defer release()
+	}
+
+	resp, wait, err := runThrottled(ctx, j.method, j.info, j.params)
+	if err != nil {
+		return failed(err.Error()) // Already validated, but a checker may still reject at run time
+	}
+	if wait > 0 {
+		return failed("This host was checked too recently, try again later")
+	}
+	return resp
+}
+
+// streamBatch writes each result as NDJSON as soon as its check finishes (completion order)
+func streamBatch(w http.ResponseWriter, r *http.Request, jobs []batchJob) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx-style proxies from buffering the stream
+	flusher, _ := w.(http.Flusher)
+
+	results := make(chan any)
+	for _, job := range jobs {
+		go func(job batchJob) {
+			results <- shapeResponse(job.run(r.Context()), job.version, job.fields)
+		}(job)
+	}
+
+	// Single writer, so lines never interleave. Never indented, one line per result.
+	for range jobs {
+		line, err := encodeJSON(<-results, false)
+		if err != nil {
+			log.Printf("JSON encode error: %v", err)
+			continue
+		}
+		w.Write(line)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const codeBodySize = "BODY_SIZE_OUT_OF_RANGE" // The body is shorter than min_body_bytes or longer than max_body_bytes
+
+// Largest min_body_bytes/max_body_bytes, and most of the body read without max_body_bytes
+const maxBodySizeCheck = 16 << 20
+
+// bodyBounds is the range min_body_bytes and max_body_bytes allow, Max is -1 without one
+type bodyBounds struct {
+	Min, Max int64
+}
+
+// parseBodyBounds reads min_body_bytes and max_body_bytes, nil when neither is given
+func parseBodyBounds(p checkParams) (*bodyBounds, error) {
+	if p.Get("min_body_bytes") == "" && p.Get("max_body_bytes") == "" {
+		return nil, nil
+	}
+	b := &bodyBounds{Max: -1}
+	for _, bound := range []struct {
+		name string
+		dst  *int64
+	}{{"min_body_bytes", &b.Min}, {"max_body_bytes", &b.Max}} {
+		s := p.Get(bound.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 || n > maxBodySizeCheck {
+			return nil, paramErrorf("%s must be between 0 and %d", bound.name, maxBodySizeCheck)
+		}
+		*bound.dst = n
+	}
+	if b.Max >= 0 && b.Min > b.Max {
+		return nil, paramErrorf("min_body_bytes can't be above max_body_bytes")
+	}
+	return b, nil
+}
+
+// checkBodySize counts the body, reading one byte past max_body_bytes to tell a longer one.
+// Without max_body_bytes it stops at maxBodySizeCheck, which is enough for any min_body_bytes.
+func checkBodySize(body io.Reader, b bodyBounds) (int64, error) {
+	limit := int64(maxBodySizeCheck)
+	if b.Max >= 0 {
+		limit = b.Max + 1
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(body, limit))
+	if err != nil {
+		return n, fmt.Errorf("reading body failed after %d bytes: %w", n, err)
+	}
+	if b.Max >= 0 && n > b.Max {
+		return n, &checkError{code: codeBodySize, err: fmt.Errorf("response body exceeds max_body_bytes=%d", b.Max)}
+	}
+	if n < b.Min {
+		return n, &checkError{code: codeBodySize, err: fmt.Errorf("response body is %d bytes, min_body_bytes=%d", n, b.Min)}
+	}
+	return n, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A latency counts as changed when it moved by at least this share of the previous value
+// and at least latencyJumpMinMs, so normal jitter on fast targets isn't reported
+const (
+	latencyJumpRatio = 0.5
+	latencyJumpMinMs = 20.0
+)
+
+// How many checks since=last remembers, and for how long after they were last polled
+const (
+	maxLastResults = 10000
+	lastResultTTL  = 24 * time.Hour
+)
+
+// FieldChange is one difference between the previous and the current response (since)
+type FieldChange struct {
+	Field string `json:"field"` // up, error_code, result or a result field like result.status
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// lastResultStore keeps the last response of checks polled with since=last
+type lastResultStore struct {
+	mu      sync.Mutex
+	entries map[string]lastResult
+	full    bool // A warning about the cap was logged
+}
+
+type lastResult struct {
+	resp   Response
+	stored time.Time
+}
+
+var lastResults = &lastResultStore{entries: make(map[string]lastResult)}
+
+// swap returns the previous response for key and stores resp in its place
+func (s *lastResultStore) swap(key string, resp Response) (prev Response, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	old, ok := s.entries[key]
+	if ok && now.Sub(old.stored) > lastResultTTL {
+		ok = false
+	}
+	if !ok && len(s.entries) >= maxLastResults {
+		s.dropExpired(now)
+		if len(s.entries) >= maxLastResults {
+			if !s.full {
+				log.Printf("WARNING: since=last remembers at most %d checks, new ones aren't tracked", maxLastResults)
+				s.full = true
+			}
+			return Response{}, false
+		}
+	}
+	s.entries[key] = lastResult{resp: resp, stored: now}
+	return old.resp, ok
+}
+
+func (s *lastResultStore) dropExpired(now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.stored) > lastResultTTL {
+			delete(s.entries, key)
+		}
+	}
+	s.full = false
+}
+
+// Params that don't change what is checked, left out of the since=last and MIN_CHECK_INTERVAL keys
+var sinceKeyIgnored = []string{"key", "since", "correlation_id", "tag", "fields", "pretty", "v", "verbose", "tz", "error_details", "precision"}
+
+// sinceKey identifies a check across polls: the method, the host and its other params
+func sinceKey(method string, p checkParams) string {
+	q := make(map[string][]string, len(p.Query))
+	for k, v := range p.Query {
+		q[k] = v
+	}
+	for _, k := range sinceKeyIgnored {
+		delete(q, k)
+	}
+	delete(q, "method")
+	delete(q, "host")
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(method + " " + hostKey(p.Host))
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", k, strings.Join(q[k], ","))
+	}
+	return b.String()
+}
+
+// parseSince reads the previous response given in since; "last" is resolved after the check
+func parseSince(p checkParams) (*Response, error) {
+	s := p.Get("since")
+	if s == "" || s == "last" {
+		return nil, nil
+	}
+	// The response may come with JSON_FIELD_NAMES=camel naming, its top-level keys are all fields
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, paramErrorf("since must be a previous response as JSON, or last: %v", err)
+	}
+	snake := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		snake[snakeCase(k)] = v
+	}
+	data, _ := json.Marshal(snake)
+	var prev Response
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return nil, paramErrorf("since must be a previous response as JSON, or last: %v", err)
+	}
+	return &prev, nil
+}
+
+// applySince compares resp with the previous response and sets Changed and Changes.
+// With since=last the previous one is what this server answered the same client last time;
+// on the first poll there's nothing to compare with yet and Changed is left out.
+func applySince(method string, p checkParams, prev *Response, resp *Response) {
+	if p.Get("since") == "last" {
+		stored, ok := lastResults.swap(p.Client+" "+sinceKey(method, p), *resp)
+		if !ok {
+			return
+		}
+		prev = &stored
+	}
+	if prev == nil {
+		return
+	}
+
+	// Both sides as JSON values, so a stored Go result compares like one sent back by a client
+	var before, after any
+	if data, err := json.Marshal(prev.Result); err == nil {
+		json.Unmarshal(data, &before)
+	}
+	if data, err := json.Marshal(resp.Result); err == nil {
+		json.Unmarshal(data, &after)
+	}
+
+	changes := []FieldChange{}
+	if prev.Up != resp.Up {
+		changes = append(changes, FieldChange{Field: "up", From: prev.Up, To: resp.Up})
+	}
+	if prev.ErrorCode != resp.ErrorCode {
+		changes = append(changes, FieldChange{Field: "error_code", From: prev.ErrorCode, To: resp.ErrorCode})
+	}
+	if prev.Error == "" && resp.Error == "" {
+		// A failed check's result is just 0, the up and error_code changes say it all
+		_, isStatus := resp.Result.(statusResult)
+		changes = diffValues(changes, "result", before, after, !isStatus)
+	}
+	changed := len(changes) > 0
+	resp.Changed = &changed
+	resp.Changes = changes
+}
+
+// diffValues appends the differences between two JSON values. Numbers under a latency
+// name (*_ms, or a plain numeric result other than a status code) only count when they
+// jumped; objects are compared field by field. A result sent back in since may have
+// camelCase fields (JSON_FIELD_NAMES=camel), so keys are matched in either naming.
+func diffValues(changes []FieldChange, path string, before, after any, latency bool) []FieldChange {
+	bm, bok := before.(map[string]any)
+	am, aok := after.(map[string]any)
+	if bok && aok {
+		// Each field by its camelCase form, with its key on either side
+		type keyPair struct{ before, after string }
+		pairs := make(map[string]*keyPair)
+		pair := func(k string) *keyPair {
+			if pairs[camelCase(k)] == nil {
+				pairs[camelCase(k)] = &keyPair{}
+			}
+			return pairs[camelCase(k)]
+		}
+		for k := range bm {
+			pair(k).before = k
+		}
+		for k := range am {
+			pair(k).after = k
+		}
+		names := make([]string, 0, len(pairs))
+		byName := make(map[string]*keyPair, len(pairs))
+		for _, kp := range pairs {
+			name := kp.after
+			if name == "" {
+				name = kp.before
+			}
+			names = append(names, name)
+			byName[name] = kp
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			kp := byName[name]
+			latency := strings.HasSuffix(name, "_ms") || strings.HasSuffix(name, "Ms")
+			changes = diffValues(changes, path+"."+name, bm[kp.before], am[kp.after], latency)
+		}
+		return changes
+	}
+
+	bf, bnum := before.(float64)
+	af, anum := after.(float64)
+	if bnum && anum && latency {
+		if diff := math.Abs(af - bf); diff >= latencyJumpMinMs && diff >= bf*latencyJumpRatio {
+			changes = append(changes, FieldChange{Field: path, From: before, To: after})
+		}
+		return changes
+	}
+
+	b, _ := json.Marshal(before)
+	a, _ := json.Marshal(after)
+	if string(a) != string(b) {
+		changes = append(changes, FieldChange{Field: path, From: before, To: after})
+	}
+	return changes
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+	_ "time/tzdata" // tz works on images without a zoneinfo database, like alpine
+)
+
+// Checker runs one kind of check. New methods implement it and are added
+// to the registry with registerMethod.
+type Checker interface {
+	Check(ctx context.Context, params checkParams) (any, error)
+}
+
+// paramValidator is implemented by checkers that can reject bad params
+// before any check runs (used to validate a whole batch up front)
+type paramValidator interface {
+	Validate(params checkParams) error
+}
+
+// longRunningChecker is implemented by checkers whose run time depends on params
+// and may exceed the server's WriteTimeout (e.g. sustained ping)
+type longRunningChecker interface {
+	MaxDuration(params checkParams) time.Duration
+}
+
+// CheckerFunc lets a plain function be used as a Checker
+type CheckerFunc func(ctx context.Context, params checkParams) (any, error)
+
+func (f CheckerFunc) Check(ctx context.Context, params checkParams) (any, error) {
+	return f(ctx, params)
+}
+
+// checkParams is the input of a single check
+type checkParams struct {
+	Host     string
+	Query    url.Values // All query params of the request
+	Body     []byte     // Body of a POST to the pinger, if any
+	BodyType string     // Its Content-Type
+	Client   string     // Address of the client that asked, keeps its since=last polls apart from others'
+}
+
+// Get returns a query param, "" if missing
+func (p checkParams) Get(name string) string {
+	return p.Query.Get(name)
+}
+
+// paramError is returned by checkers for invalid input.
+// handleRequest answers it with a 400 instead of a failed check.
+type paramError struct {
+	msg string
+}
+
+func (e paramError) Error() string { return e.msg }
+
+func paramErrorf(format string, args ...any) error {
+	return paramError{fmt.Sprintf(format, args...)}
+}
+
+// Error codes reported in Response.ErrorCode
+const (
+	codeConnectTimeout = "CONNECT_TIMEOUT"    // No connection within connect_timeout
+	codeReadTimeout    = "READ_TIMEOUT"       // Connected, but no complete answer within timeout
+	codeConnRefused    = "CONNECTION_REFUSED" // Target actively refused the connection
+	codeTTLExceeded    = "TTL_EXCEEDED"       // A router on the path answered ping's ttl with time exceeded
+	codeTimeout        = "TIMEOUT"            // Cut short before it completed, see partialError
+)
+
+// checkError is a check failure with a machine-readable code
+type checkError struct {
+	code string
+	err  error
+}
+
+func (e *checkError) Error() string { return e.err.Error() }
+
+func (e *checkError) Unwrap() error { return e.err }
+
+// partialError is returned together with the data a check collected before it was
+// cut short, e.g. 2 of 5 samples. The check still fails, but the result is kept.
+type partialError struct {
+	err error
+}
+
+func (e partialError) Error() string { return e.err.Error() }
+
+func (e partialError) Unwrap() error { return e.err }
+
+// errorCode finds the code of a (possibly wrapped) checkError, "" if there is none
+func errorCode(err error) string {
+	var ce *checkError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return codeConnRefused
+	}
+	return ""
+}
+
+// Default overall timeout of a check
+const defaultCheckTimeout = 5 * time.Second
+
+// durationParam reads a timeout-like param given as a Go duration ("1500ms") or in seconds ("2")
+func (p checkParams) durationParam(name string, def time.Duration) (time.Duration, error) {
+	str := p.Get(name)
+	if str == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		secs, serr := strconv.ParseFloat(str, 64)
+		if serr != nil {
+			return 0, paramErrorf("invalid %s %q", name, str)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, paramErrorf("%s must be positive", name)
+	}
+	return d, nil
+}
+
+// Ceiling for the timeout param (MAX_TIMEOUT), longer values are clamped
+var maxTimeout = 30 * time.Second
+
+// timeouts reads timeout and connect_timeout; the connect timeout defaults to the overall one
+func (p checkParams) timeouts() (total, connect time.Duration, err error) {
+	if total, err = p.durationParam("timeout", defaultCheckTimeout); err != nil {
+		return 0, 0, err
+	}
+	total = min(total, maxTimeout)
+	if connect, err = p.durationParam("connect_timeout", total); err != nil {
+		return 0, 0, err
+	}
+	return total, min(connect, total), nil
+}
+
+// timeoutClamped reports whether the requested timeout was lowered to MAX_TIMEOUT
+func (p checkParams) timeoutClamped() bool {
+	total, err := p.durationParam("timeout", defaultCheckTimeout)
+	return err == nil && total > maxTimeout
+}
+
+// Upper bound for retries, and the pause before each retry
+const (
+	maxRetries = 5
+	retryDelay = 250 * time.Millisecond
+)
+
+// retries is how often a failed check is run again, 0 for methods without the param
+func (p checkParams) retries(m methodInfo) (int, error) {
+	s := p.Get("retries")
+	if s == "" || !m.hasParam("retries") {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > maxRetries {
+		return 0, paramErrorf("retries must be between 0 and %d", maxRetries)
+	}
+	return n, nil
+}
+
+// precision is how many decimals latencies get in the response, defaultPrecision without the param
+func (p checkParams) precision() (int, error) {
+	s := p.Get("precision")
+	if s == "" {
+		return defaultPrecision, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > maxPrecision {
+		return 0, paramErrorf("precision must be between 0 and %d", maxPrecision)
+	}
+	return n, nil
+}
+
+// location is the time zone of the response timestamp (tz), UTC by default
+func (p checkParams) location() (*time.Location, error) {
+	tz := p.Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, paramErrorf("tz must be an IANA time zone name, e.g. Europe/Berlin: %v", err)
+	}
+	return loc, nil
+}
+
+// Longer correlation IDs are cut, they're echoed into every response and log line
+const maxCorrelationID = 128
+
+// correlationID is the caller's correlation_id, or tag as a shorter alias
+func (p checkParams) correlationID() string {
+	id := p.Get("correlation_id")
+	if id == "" {
+		id = p.Get("tag")
+	}
+	if len(id) > maxCorrelationID {
+		id = id[:maxCorrelationID]
+	}
+	return id
+}
+
+// durationMs converts a duration to fractional milliseconds with microsecond precision
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterCheckerFunc(t *testing.T) {
+	registerMethod(methodInfo{
+		Name:        "test_echo",
+		Description: "Echoes the host back, for tests",
+		Params:      []methodParam{hostParam, {Name: "fail", Description: "Set to true for a param error"}},
+		Result:      "object {host}",
+	}, CheckerFunc(func(ctx context.Context, p checkParams) (any, error) {
+		if p.Get("fail") == "true" {
+			return 0, paramErrorf("fail requested")
+		}
+		return map[string]string{"host": p.Host}, nil
+	}))
+
+	rec := httptest.NewRecorder()
+	handleRequest(rec, httptest.NewRequest(http.MethodGet, "/?method=test_echo&host=example.com", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Type   string            `json:"type"`
+		Up     bool              `json:"up"`
+		Result map[string]string `json:"result"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if resp.Type != "test_echo" || !resp.Up || resp.Result["host"] != "example.com" {
+		t.Errorf("response = %s, want an up test_echo result for example.com", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handleRequest(rec, httptest.NewRequest(http.MethodGet, "/?method=test_echo&host=example.com&fail=true", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Error != "fail requested" {
+		t.Errorf("body = %s, want error %q", rec.Body, "fail requested")
+	}
+}
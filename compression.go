@@ -0,0 +1,88 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Encodings offered with check_compression=true
+const compressionAcceptEncoding = "gzip, br"
+
+// Bounds on how much of the body is read and inflated to compute the ratio
+const (
+	maxCompressedRead   = 1 << 20
+	maxDecompressedRead = 16 << 20
+)
+
+// CompressionResult reports how the server encoded the response body
+type CompressionResult struct {
+	Encoding          string   `json:"encoding"` // identity when the body wasn't compressed
+	CompressedBytes   int64    `json:"compressed_bytes"`
+	DecompressedBytes int64    `json:"decompressed_bytes"`
+	Ratio             *float64 `json:"ratio,omitempty"`     // decompressed / compressed, omitted if unknown
+	Truncated         bool     `json:"truncated,omitempty"` // Body exceeded the read limits, sizes cover only the part read
+	Error             string   `json:"error,omitempty"`
+}
+
+// measureCompression reads up to maxCompressedRead bytes of body and inflates them
+func measureCompression(encoding string, body io.Reader) *CompressionResult {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		encoding = "identity"
+	}
+	res := &CompressionResult{Encoding: encoding}
+
+	counter := &countingReader{r: io.LimitReader(body, maxCompressedRead)}
+	var inflated io.Reader
+	switch encoding {
+	case "identity":
+		inflated = counter
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(counter)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		defer zr.Close()
+		inflated = zr
+	case "br":
+		inflated = brotli.NewReader(counter)
+	default:
+		n, _ := io.Copy(io.Discard, counter)
+		res.CompressedBytes = n
+		res.Error = "unsupported content encoding"
+		return res
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(inflated, maxDecompressedRead+1))
+	res.CompressedBytes = counter.n
+	res.DecompressedBytes = min(n, maxDecompressedRead)
+	if n > maxDecompressedRead || counter.n == maxCompressedRead {
+		res.Truncated = true
+	} else if err != nil {
+		res.Error = err.Error()
+	}
+
+	if res.CompressedBytes > 0 {
+		ratio := float64(res.DecompressedBytes) / float64(res.CompressedBytes)
+		ratio = math.Round(ratio*100) / 100
+		res.Ratio = &ratio
+	}
+	return res
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// semaphore is a counting semaphore whose limit can be changed while it's in use.
+// Lowering the limit doesn't interrupt running checks, new ones just wait until
+// enough of them have finished.
+//
+// A limit of 0 means unlimited (CONCURRENCY_LIMIT=0): slots are still counted for
+// stats, but never refused. A nil *semaphore behaves the same, so a missing
+// initialization degrades to no limit instead of a panic.
+type semaphore struct {
+	mu    sync.Mutex
+	limit int
+	inUse int
+	wake  chan struct{} // Closed and replaced whenever a slot may have become free
+}
+
+func newSemaphore(limit int) *semaphore {
+	return &semaphore{limit: limit, wake: make(chan struct{})}
+}
+
+// tryAcquire takes a slot without waiting
+func (s *semaphore) tryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.free() {
+		return false
+	}
+	s.inUse++
+	return true
+}
+
+// acquire waits for a slot until ctx ends
+func (s *semaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	for {
+		s.mu.Lock()
+		if s.free() {
+			s.inUse++
+			s.mu.Unlock()
+			return nil
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *semaphore) release() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.inUse--
+	s.notify()
+	s.mu.Unlock()
+}
+
+// setLimit changes the limit; waiters are woken so a raise takes effect right away
+func (s *semaphore) setLimit(limit int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.limit = limit
+	s.notify()
+	s.mu.Unlock()
+}
+
+// stats returns the current limit and the number of slots taken
+func (s *semaphore) stats() (limit, inUse int) {
+	if s == nil {
+		return 0, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit, s.inUse
+}
+
+// free reports whether a slot can be taken, s.mu must be held
+func (s *semaphore) free() bool {
+	return s.limit <= 0 || s.inUse < s.limit
+}
+
+// notify wakes all waiters, s.mu must be held
+func (s *semaphore) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// Separate key for /admin endpoints (ADMIN_KEY), API_KEY is used when empty
+var adminKey string
+
+// adminAuthorized requires ADMIN_KEY, or API_KEY if no admin key is set.
+// Without either, admin endpoints stay closed.
+func adminAuthorized(r *http.Request) bool {
+	key := adminKey
+	if key == "" {
+		key = apiKey
+	}
+	return key != "" && checkKey(r, key)
+}
+
+// handleAdminConcurrency reports the concurrency limit (GET) or changes it (PUT ?limit=N)
+func handleAdminConcurrency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !adminAuthorized(r) {
+		writeError(w, http.StatusForbidden, "Auth failed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer, or 0 for unlimited")
+			return
+		}
+		old, _ := concurrencyLimit.stats()
+		concurrencyLimit.setLimit(limit)
+		log.Printf("Concurrency limit changed from %d to %d", old, limit)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, http.StatusMethodNotAllowed, "GET or PUT required")
+		return
+	}
+
+	limit, inUse := concurrencyLimit.stats()
+	body := map[string]int{"limit": limit, "in_use": inUse}
+	writeJSON(w, r, body)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreUnlimited(t *testing.T) {
+	s := newSemaphore(0)
+	for i := 0; i < 100; i++ {
+		if !s.tryAcquire() {
+			t.Fatalf("tryAcquire %d refused with limit 0", i)
+		}
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire with limit 0: %v", err)
+	}
+	if limit, inUse := s.stats(); limit != 0 || inUse != 101 {
+		t.Errorf("stats = %d, %d, want 0, 101", limit, inUse)
+	}
+	s.release()
+	if _, inUse := s.stats(); inUse != 100 {
+		t.Errorf("in use after release = %d, want 100", inUse)
+	}
+}
+
+func TestSemaphoreNil(t *testing.T) {
+	var s *semaphore
+	if !s.tryAcquire() {
+		t.Error("tryAcquire on nil semaphore refused")
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		t.Errorf("acquire on nil semaphore: %v", err)
+	}
+	s.release()
+	s.setLimit(3)
+	if limit, inUse := s.stats(); limit != 0 || inUse != 0 {
+		t.Errorf("stats of nil semaphore = %d, %d, want 0, 0", limit, inUse)
+	}
+}
+
+func TestSemaphoreSetLimitWakesWaiters(t *testing.T) {
+	s := newSemaphore(1)
+	if !s.tryAcquire() {
+		t.Fatal("first tryAcquire refused")
+	}
+	if s.tryAcquire() {
+		t.Fatal("tryAcquire above the limit succeeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- s.acquire(ctx) }()
+	}
+	// Let both block before raising the limit
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		select {
+		case err := <-done:
+			t.Fatalf("acquire returned before the limit was raised: %v", err)
+		default:
+		}
+	}
+
+	s.setLimit(3)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("waiter %d: %v", i, err)
+		}
+	}
+	if limit, inUse := s.stats(); limit != 3 || inUse != 3 {
+		t.Errorf("stats = %d, %d, want 3, 3", limit, inUse)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const codeProxyHandshake = "PROXY_HANDSHAKE_FAILED" // The HTTP proxy was reached but didn't open the tunnel
+
+// httpConnectDialer opens connections through an HTTP proxy with CONNECT (connect_proxy)
+type httpConnectDialer struct {
+	addr string
+	auth string // Proxy-Authorization value, empty without credentials
+}
+
+// connectDialer parses connect_proxy: host:port or http://[user:pass@]host:port
+func connectDialer(addr string) (contextDialer, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme != "http" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("invalid connect_proxy %q", addr)
+	}
+	d := &httpConnectDialer{addr: u.Host}
+	if u.Port() == "" {
+		d.addr = net.JoinHostPort(u.Hostname(), "8080")
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		d.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+pass))
+	}
+	return d, nil
+}
+
+// DialContext connects to the proxy and asks it for a tunnel to addr. The proxy resolves
+// the target's name. Failures to reach the proxy are proxyDialErrors, a refused tunnel
+// is a PROXY_HANDSHAKE_FAILED; 502 and 504 mean the proxy couldn't reach the target.
+func (d *httpConnectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("connect_proxy only tunnels TCP, not %s", network)
+	}
+	conn, err := directDialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, &proxyDialError{kind: "http", addr: d.addr, err: err}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.auth != "" {
+		req.Header.Set("Proxy-Authorization", d.auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, d.handshakeError(ctx, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, d.handshakeError(ctx, err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusBadGateway:
+		// The proxy is fine, it's the target it couldn't connect to
+		conn.Close()
+		return nil, fmt.Errorf("http proxy %s couldn't connect to %s: %s", d.addr, addr, resp.Status)
+	case resp.StatusCode == http.StatusGatewayTimeout:
+		conn.Close()
+		return nil, &checkError{code: codeConnectTimeout, err: fmt.Errorf("http proxy %s timed out connecting to %s: %s", d.addr, addr, resp.Status)}
+	case resp.StatusCode/100 != 2:
+		conn.Close()
+		return nil, &checkError{code: codeProxyHandshake, err: fmt.Errorf("http proxy %s refused CONNECT to %s: %s", d.addr, addr, resp.Status)}
+	}
+	if br.Buffered() > 0 {
+		// The target can't have spoken before the tunnel was confirmed to us
+		conn.Close()
+		return nil, &checkError{code: codeProxyHandshake, err: fmt.Errorf("http proxy %s sent data after its CONNECT reply", d.addr)}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (d *httpConnectDialer) handshakeError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return &checkError{code: codeProxyHandshake, err: fmt.Errorf("http proxy %s CONNECT failed: %w", d.addr, err)}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// Upper bound for backend_samples, the samples run one after another
+const maxBackendSamples = 50
+
+// BackendDistribution counts which backend answered repeated requests (backend_samples)
+type BackendDistribution struct {
+	Samples  int            `json:"samples"`
+	Failed   int            `json:"failed"`
+	Distinct int            `json:"distinct"`
+	Counts   map[string]int `json:"counts"` // Backend IP, or backend_header value, to the number of answers
+}
+
+// sampleBackends sends n requests on fresh connections, so every one goes through DNS and
+// the load balancer again, and counts the backend of each. Samples still running when ctx
+// ends are counted as failed.
+func sampleBackends(ctx context.Context, url string, opts httpOptions, n int) *BackendDistribution {
+	dist := &BackendDistribution{Samples: n, Counts: make(map[string]int)}
+	opts.KeepAlive = false
+	client, done := checkClient(opts)
+	defer done()
+
+	for i := 0; i < n; i++ {
+		backend, ok := sampleBackend(ctx, client, url, opts)
+		if !ok {
+			dist.Failed++
+			continue
+		}
+		dist.Counts[backend]++
+	}
+	dist.Distinct = len(dist.Counts)
+	return dist
+}
+
+// sampleBackend makes one request and names its backend: the backend_header value, or the
+// address connected to. A response without the header counts as "(none)".
+func sampleBackend(ctx context.Context, client *http.Client, url string, opts httpOptions) (string, bool) {
+	var mu sync.Mutex
+	var remote string
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				mu.Lock()
+				remote = host
+				mu.Unlock()
+			}
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, opts.Method, url, bytes.NewReader(opts.Body))
+	if err != nil {
+		return "", false
+	}
+	if opts.ContentType != "" {
+		req.Header.Set("Content-Type", opts.ContentType)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false
+	}
+	resp.Body.Close()
+
+	if opts.BackendHeader != "" {
+		if v := resp.Header.Get(opts.BackendHeader); v != "" {
+			return v, true
+		}
+		return "(none)", true
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return remote, remote != ""
+}
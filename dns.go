@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	codeDNSNotFound       = "DNS_NOT_FOUND"        // Name or record doesn't exist
+	codeNoAddressInFamily = "NO_ADDRESS_IN_FAMILY" // Name resolves, but not in the requested family
+)
+
+var dnsRecordTypes = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true, "TXT": true, "SRV": true, "PTR": true,
+}
+
+// MXRecord is one mail exchanger
+type MXRecord struct {
+	Host string `json:"host"`
+	Pref uint16 `json:"pref"`
+}
+
+// SRVRecord is one service location
+type SRVRecord struct {
+	Target   string `json:"target"`
+	Port     uint16 `json:"port"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+}
+
+// SRVTargetCheck is the TCP connect to the preferred SRV target (check_target=true)
+type SRVTargetCheck struct {
+	Address   string  `json:"address"`
+	ConnectMs float64 `json:"connect_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DNSResult holds the answers for the requested record type
+type DNSResult struct {
+	Record  string          `json:"record"`
+	Name    string          `json:"name"`
+	Answers []string        `json:"answers,omitempty"` // A, AAAA, CNAME, NS, TXT
+	MX      []MXRecord      `json:"mx,omitempty"`
+	SRV     []SRVRecord     `json:"srv,omitempty"`
+	Target  *SRVTargetCheck `json:"target,omitempty"`
+	FCrDNS  *FCrDNSCheck    `json:"fcrdns,omitempty"`
+	CNAME   *CNAMETrace     `json:"cname_chain,omitempty"` // With trace_cname=true
+	TTLs    []RecordTTL     `json:"ttls,omitempty"`        // With return_ttl=true
+}
+
+// FCrDNSCheck is the forward lookup of the PTR names (record=PTR&fcrdns=true)
+type FCrDNSCheck struct {
+	Match     bool     `json:"match"`               // At least one PTR name resolves back to the address
+	Confirmed []string `json:"confirmed,omitempty"` // PTR names that resolve back to the address
+}
+
+// Up is false when the SRV target was checked and couldn't be reached, or FCrDNS didn't match
+func (r DNSResult) Up() bool {
+	return (r.Target == nil || r.Target.Error == "") && (r.FCrDNS == nil || r.FCrDNS.Match)
+}
+
+// dnsChecker looks up a record with the system resolver
+type dnsChecker struct{}
+
+func (dnsChecker) Validate(p checkParams) error {
+	if _, err := dnsRecordType(p); err != nil {
+		return err
+	}
+	_, _, err := p.timeouts()
+	return err
+}
+
+func dnsRecordType(p checkParams) (string, error) {
+	record := strings.ToUpper(p.Get("record"))
+	if record == "" {
+		record = "A"
+	}
+	if !dnsRecordTypes[record] {
+		return "", paramErrorf("unsupported record %q", record)
+	}
+	if record != "SRV" && (p.Get("service") != "" || p.Get("check_target") == "true") {
+		return "", paramErrorf("service and check_target need record=SRV")
+	}
+	if record == "PTR" && net.ParseIP(strings.Trim(p.Host, "[]")) == nil {
+		return "", paramErrorf("record=PTR needs an IP address as host")
+	}
+	if record != "PTR" && p.Get("fcrdns") == "true" {
+		return "", paramErrorf("fcrdns needs record=PTR")
+	}
+	if record == "PTR" && p.Get("trace_cname") == "true" {
+		return "", paramErrorf("trace_cname can't be combined with record=PTR")
+	}
+	return record, nil
+}
+
+func (dnsChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	record, err := dnsRecordType(p)
+	if err != nil {
+		return 0, err
+	}
+	timeout, connectTimeout, err := p.timeouts()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name := strings.TrimSuffix(p.Host, ".")
+	if service := strings.Trim(p.Get("service"), "."); service != "" {
+		name = service + "." + name // _sip._tcp + example.com
+	}
+	res := DNSResult{Record: record, Name: name}
+	r := net.DefaultResolver
+
+	switch record {
+	case "A", "AAAA":
+		network := "ip4"
+		if record == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return 0, dnsError(err)
+		}
+		for _, ip := range ips {
+			res.Answers = append(res.Answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return 0, dnsError(err)
+		}
+		res.Answers = []string{cname}
+	case "NS":
+		nss, err := r.LookupNS(ctx, name)
+		if err != nil {
+			return 0, dnsError(err)
+		}
+		for _, ns := range nss {
+			res.Answers = append(res.Answers, ns.Host)
+		}
+	case "TXT":
+		if res.Answers, err = r.LookupTXT(ctx, name); err != nil {
+			return 0, dnsError(err)
+		}
+	case "MX":
+		mxs, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return 0, dnsError(err)
+		}
+		for _, mx := range mxs {
+			res.MX = append(res.MX, MXRecord{Host: mx.Host, Pref: mx.Pref})
+		}
+	case "SRV":
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return 0, dnsError(err)
+		}
+		for _, srv := range srvs {
+			res.SRV = append(res.SRV, SRVRecord{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+		}
+		if p.Get("check_target") == "true" && len(srvs) > 0 {
+			// LookupSRV sorts by priority, then shuffles by weight, so the first one is the pick
+			res.Target = checkSRVTarget(ctx, srvs[0], tcpOptions{Timeout: timeout, ConnectTimeout: connectTimeout})
+		}
+	case "PTR":
+		ip := net.ParseIP(strings.Trim(p.Host, "[]"))
+		res.Name = ip.String()
+		if res.Answers, err = r.LookupAddr(ctx, res.Name); err != nil {
+			return 0, dnsError(err)
+		}
+		if p.Get("fcrdns") == "true" {
+			res.FCrDNS = checkFCrDNS(ctx, ip, res.Answers)
+		}
+	}
+	if p.Get("trace_cname") == "true" {
+		res.CNAME = traceCNAME(ctx, name)
+	}
+	if p.Get("return_ttl") == "true" {
+		qname := name
+		if record == "PTR" {
+			qname = reverseName(net.ParseIP(res.Name))
+		}
+		if res.TTLs, err = recordTTLs(ctx, qname, record); err != nil {
+			return 0, err
+		}
+	}
+	return res, nil
+}
+
+func checkSRVTarget(ctx context.Context, srv *net.SRV, opts tcpOptions) *SRVTargetCheck {
+	target := &SRVTargetCheck{Address: net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))}
+	ms, err := checkTCP(ctx, target.Address, "", opts)
+	if err != nil {
+		target.Error = err.Error()
+		return target
+	}
+	target.ConnectMs = ms.(float64)
+	return target
+}
+
+// checkFCrDNS resolves each PTR name and looks for ip among its addresses.
+// Names that fail to resolve just don't confirm.
+func checkFCrDNS(ctx context.Context, ip net.IP, names []string) *FCrDNSCheck {
+	check := &FCrDNSCheck{}
+	for _, name := range names {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.IP.Equal(ip) {
+				check.Confirmed = append(check.Confirmed, name)
+				break
+			}
+		}
+	}
+	check.Match = len(check.Confirmed) > 0
+	return check
+}
+
+// dnsError gives lookups of names or records that don't exist an error code
+func dnsError(err error) error {
+	var de *net.DNSError
+	if errors.As(err, &de) && de.IsNotFound {
+		return &checkError{code: codeDNSNotFound, err: fmt.Errorf("dns lookup failed: %w", err)}
+	}
+	return fmt.Errorf("dns lookup failed: %w", err)
+}
+
+// checkFamily makes sure host resolves to an address of the given family ("4" or "6").
+// A name that only has addresses of the other family gets NO_ADDRESS_IN_FAMILY
+// instead of the opaque failure of the check itself. IP literals are left to the caller.
+func checkFamily(ctx context.Context, host, family string) error {
+	if family == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+	network, other, otherName := "ip4", "ip6", "IPv6"
+	if family == "6" {
+		network, other, otherName = "ip6", "ip4", "IPv4"
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err == nil && len(ips) > 0 {
+		return nil
+	}
+	if others, oerr := net.DefaultResolver.LookupIP(ctx, other, host); oerr == nil && len(others) > 0 {
+		return &checkError{code: codeNoAddressInFamily, err: fmt.Errorf("%s has no IPv%s address, only %s", host, family, otherName)}
+	}
+	if err != nil {
+		return dnsError(err)
+	}
+	return &checkError{code: codeDNSNotFound, err: fmt.Errorf("dns lookup failed: no addresses for %s", host)}
+}
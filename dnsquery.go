@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Records a CNAME trace follows before giving up on a loop or an absurd chain
+const maxCNAMEHops = 16
+
+// dnsServer is the first nameserver in /etc/resolv.conf, the one the system resolver asks first
+func dnsServer() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			fields := strings.Fields(s.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// dnsQuery sends one recursive query to the system's nameserver, over UDP and
+// again over TCP when the answer was truncated. The net package's resolver hides
+// the individual records, which CNAME tracing and TTLs need.
+func dnsQuery(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(dnsFQDN(name))
+	if err != nil {
+		return nil, paramErrorf("invalid name %q", name)
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Intn(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	server := dnsServer()
+	msg, err := dnsExchange(ctx, "udp", server, packed, query.ID)
+	if err == nil && msg.Truncated {
+		msg, err = dnsExchange(ctx, "tcp", server, packed, query.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dns query to %s failed: %w", server, err)
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+		return msg, nil
+	case dnsmessage.RCodeNameError:
+		return nil, &checkError{code: codeDNSNotFound, err: fmt.Errorf("dns lookup failed: no such host %s", name)}
+	}
+	return nil, fmt.Errorf("dns lookup failed: server answered %s", msg.RCode)
+}
+
+func dnsExchange(ctx context.Context, network, server string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	var buf []byte
+	if network == "tcp" {
+		// Over TCP every message is prefixed with its length
+		if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(packed)))); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return nil, err
+	}
+	if msg.ID != id {
+		return nil, errors.New("answer doesn't match the query")
+	}
+	return &msg, nil
+}
+
+// dnsFQDN adds the root dot dnsmessage names need
+func dnsFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// CNAMETrace is the chain of aliases behind a name (trace_cname=true)
+type CNAMETrace struct {
+	Chain     []string `json:"chain"`     // The name asked for, then each CNAME target in order
+	Canonical string   `json:"canonical"` // The last name of the chain, the one holding the addresses
+	Error     string   `json:"error,omitempty"`
+}
+
+// traceCNAME follows the CNAME records from name, hop by hop. Resolvers usually return the
+// whole chain with the first answer; a chain that stops short is queried again from its end.
+func traceCNAME(ctx context.Context, name string) *CNAMETrace {
+	name = dnsFQDN(name)
+	trace := &CNAMETrace{Chain: []string{name}, Canonical: name}
+	seen := map[string]bool{strings.ToLower(name): true}
+	current := name
+	for {
+		msg, err := dnsQuery(ctx, current, dnsmessage.TypeA)
+		if err != nil {
+			trace.Error = err.Error()
+			return trace
+		}
+		targets := make(map[string]string)
+		for _, rr := range msg.Answers {
+			if cname, ok := rr.Body.(*dnsmessage.CNAMEResource); ok {
+				targets[strings.ToLower(rr.Header.Name.String())] = cname.CNAME.String()
+			}
+		}
+
+		followed := false
+		for {
+			target, ok := targets[strings.ToLower(current)]
+			if !ok {
+				break
+			}
+			if seen[strings.ToLower(target)] || len(trace.Chain) > maxCNAMEHops {
+				trace.Error = fmt.Sprintf("CNAME loop or chain longer than %d at %s", maxCNAMEHops, target)
+				return trace
+			}
+			seen[strings.ToLower(target)] = true
+			trace.Chain = append(trace.Chain, target)
+			trace.Canonical = target
+			current = target
+			followed = true
+		}
+		// Done when this round added nothing, or the chain ended at a name with records of its own
+		if !followed || dnsHasRecords(msg, current) {
+			return trace
+		}
+	}
+}
+
+// dnsHasRecords reports whether the answer has anything other than a CNAME for name
+func dnsHasRecords(msg *dnsmessage.Message, name string) bool {
+	for _, rr := range msg.Answers {
+		if rr.Header.Type != dnsmessage.TypeCNAME && strings.EqualFold(rr.Header.Name.String(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordTTL is one answer record with its TTL (return_ttl=true)
+type RecordTTL struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"` // CNAMEs leading to name show up along with the records asked for
+	TTL   uint32 `json:"ttl"`
+	Value string `json:"value"`
+}
+
+var dnsQueryTypes = map[string]dnsmessage.Type{
+	"A": dnsmessage.TypeA, "AAAA": dnsmessage.TypeAAAA, "CNAME": dnsmessage.TypeCNAME, "MX": dnsmessage.TypeMX,
+	"NS": dnsmessage.TypeNS, "TXT": dnsmessage.TypeTXT, "SRV": dnsmessage.TypeSRV, "PTR": dnsmessage.TypePTR,
+}
+
+// recordTTLs queries name for record again, this time keeping the TTL of each answer.
+// From a caching resolver that's the time left until it asks again, not the zone's TTL.
+func recordTTLs(ctx context.Context, name, record string) ([]RecordTTL, error) {
+	msg, err := dnsQuery(ctx, name, dnsQueryTypes[record])
+	if err != nil {
+		return nil, err
+	}
+	ttls := []RecordTTL{}
+	for _, rr := range msg.Answers {
+		value, ok := dnsRecordValue(rr.Body)
+		if !ok {
+			continue
+		}
+		ttls = append(ttls, RecordTTL{
+			Name:  rr.Header.Name.String(),
+			Type:  strings.TrimPrefix(rr.Header.Type.String(), "Type"),
+			TTL:   rr.Header.TTL,
+			Value: value,
+		})
+	}
+	return ttls, nil
+}
+
+// dnsRecordValue formats a record the way the answers of the dns check show it
+func dnsRecordValue(body dnsmessage.ResourceBody) (string, bool) {
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(b.A[:]).String(), true
+	case *dnsmessage.AAAAResource:
+		return net.IP(b.AAAA[:]).String(), true
+	case *dnsmessage.CNAMEResource:
+		return b.CNAME.String(), true
+	case *dnsmessage.NSResource:
+		return b.NS.String(), true
+	case *dnsmessage.PTRResource:
+		return b.PTR.String(), true
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", b.Pref, b.MX), true
+	case *dnsmessage.TXTResource:
+		return strings.Join(b.TXT, ""), true
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, b.Target), true
+	}
+	return "", false
+}
+
+// reverseName is the in-addr.arpa or ip6.arpa name of ip, as queried for PTR
+func reverseName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", v4[3], v4[2], v4[1], v4[0])
+	}
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
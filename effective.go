@@ -0,0 +1,78 @@
+package main
+
+// paramsResolver is implemented by checkers that can tell the values they actually apply,
+// after defaults, clamping and values implied by other params
+type paramsResolver interface {
+	EffectiveParams(p checkParams) map[string]any
+}
+
+// effectiveParams lists the params a check ran with (verbose=true): the documented params
+// as given or defaulted, overridden by what the checker resolved them to
+func effectiveParams(method string, m methodInfo, p checkParams) map[string]any {
+	params := map[string]any{"method": method}
+	for _, mp := range m.Params {
+		switch {
+		case mp.Name == "host":
+		case p.Query.Has(mp.Name):
+			params[mp.Name] = p.Get(mp.Name)
+		case mp.Default != "":
+			params[mp.Name] = mp.Default
+		}
+	}
+
+	// The usual overall/connect timeout pair, after clamping to MAX_TIMEOUT
+	if m.hasParam("connect_timeout") {
+		if total, connect, err := p.timeouts(); err == nil {
+			params["timeout"] = total.String()
+			params["connect_timeout"] = connect.String()
+		}
+	}
+	if r, ok := m.checker.(paramsResolver); ok {
+		for k, v := range r.EffectiveParams(p) {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+func (pingChecker) EffectiveParams(p checkParams) map[string]any {
+	opts, err := parsePingOptions(p)
+	if err != nil {
+		return nil
+	}
+	params := map[string]any{"timeout": opts.PacketTimeout.String(), "count": pingCount}
+	if opts.Duration > 0 {
+		params["duration"] = opts.Duration.String()
+		params["count"] = int(opts.Duration.Seconds()) // One a second
+	}
+	if opts.Deadline > 0 {
+		params["deadline"] = opts.Deadline.String()
+	}
+	if opts.Family != "" {
+		params["family"] = opts.Family
+	}
+	if opts.Pattern != "" {
+		params["pattern"] = opts.Pattern
+	}
+	return params
+}
+
+func (httpChecker) EffectiveParams(p checkParams) map[string]any {
+	opts, err := parseHTTPOptions(p)
+	if err != nil {
+		return nil
+	}
+	return map[string]any{"http_method": opts.Method, "max_redirects": opts.MaxRedirects}
+}
+
+func (pmtuChecker) EffectiveParams(p checkParams) map[string]any {
+	opts, err := parsePMTUOptions(p)
+	if err != nil {
+		return nil
+	}
+	params := map[string]any{"max_mtu": opts.Max, "timeout": opts.Timeout.String()}
+	if opts.Family != "" {
+		params["family"] = opts.Family
+	}
+	return params
+}
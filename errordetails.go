@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrorDetails is the structured side of a failed check's error (error_details=true), for
+// callers that need more than error_code without parsing the message
+type ErrorDetails struct {
+	Type string `json:"type"` // certificate_invalid, certificate_untrusted, hostname_mismatch, tls_alert, proxy, dns or network
+
+	Cert         *CertDetails `json:"cert,omitempty"`          // The certificate that failed verification
+	Reason       string       `json:"reason,omitempty"`        // Why it failed, e.g. expired or not authorized to sign other certificates
+	ExpectedName string       `json:"expected_name,omitempty"` // Name (SNI) the certificate was checked against, for hostname_mismatch
+	Alert        string       `json:"alert,omitempty"`         // TLS alert sent by the server, e.g. handshake failure
+
+	ProxyType string `json:"proxy_type,omitempty"` // socks5 or http
+	Name      string `json:"name,omitempty"`       // DNS name looked up
+	Server    string `json:"server,omitempty"`     // DNS server asked, when known
+	Op        string `json:"op,omitempty"`         // Network operation, e.g. dial or read
+	Network   string `json:"network,omitempty"`
+	Address   string `json:"address,omitempty"` // Remote address of the operation, or the proxy's
+	Timeout   bool   `json:"timeout,omitempty"`
+	NotFound  bool   `json:"not_found,omitempty"` // No such host
+}
+
+// CertDetails identifies a certificate in ErrorDetails
+type CertDetails struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	DNSNames  []string `json:"dns_names,omitempty"`
+	NotBefore string   `json:"not_before"`
+	NotAfter  string   `json:"not_after"`
+}
+
+// rewordedError gives an error a shorter message, but keeps the original for error_details
+type rewordedError struct {
+	msg   string
+	cause error
+}
+
+func (e *rewordedError) Error() string { return e.msg }
+
+func (e *rewordedError) Unwrap() error { return e.cause }
+
+// errorDetails digs the most specific known error out of err's chain, nil if there's none
+func errorDetails(err error) *ErrorDetails {
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var alert tls.AlertError
+	var proxy *proxyDialError
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+
+	switch {
+	case errors.As(err, &invalid):
+		reason := "invalid"
+		switch {
+		case invalid.Reason == x509.Expired && invalid.Cert != nil && time.Now().Before(invalid.Cert.NotBefore):
+			reason = "not yet valid"
+		case invalid.Reason == x509.Expired:
+			reason = "expired"
+		case invalid.Detail != "":
+			reason = invalid.Detail
+		}
+		return &ErrorDetails{Type: "certificate_invalid", Cert: certDetails(invalid.Cert), Reason: reason}
+	case errors.As(err, &unknown):
+		return &ErrorDetails{Type: "certificate_untrusted", Cert: certDetails(unknown.Cert), Reason: "signed by an unknown authority"}
+	case errors.As(err, &hostname):
+		return &ErrorDetails{Type: "hostname_mismatch", Cert: certDetails(hostname.Certificate), ExpectedName: hostname.Host}
+	case errors.As(err, &alert):
+		return &ErrorDetails{Type: "tls_alert", Alert: alert.Error()}
+	case errors.As(err, &proxy):
+		d := &ErrorDetails{Type: "proxy", ProxyType: proxy.kind, Address: proxy.addr}
+		if errors.As(err, &opErr) {
+			d.Op, d.Timeout = opErr.Op, opErr.Timeout()
+		}
+		return d
+	case errors.As(err, &dnsErr):
+		return &ErrorDetails{Type: "dns", Name: dnsErr.Name, Server: dnsErr.Server, Timeout: dnsErr.IsTimeout, NotFound: dnsErr.IsNotFound}
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// How crypto/tls reports an alert from the server
+		return &ErrorDetails{Type: "tls_alert", Alert: opErr.Err.Error()}
+	case errors.As(err, &opErr):
+		d := &ErrorDetails{Type: "network", Op: opErr.Op, Network: opErr.Net, Timeout: opErr.Timeout()}
+		if opErr.Addr != nil {
+			d.Address = opErr.Addr.String()
+		}
+		return d
+	}
+	return nil
+}
+
+func certDetails(cert *x509.Certificate) *CertDetails {
+	if cert == nil {
+		return nil
+	}
+	return &CertDetails{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:  cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+}
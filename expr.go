@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bounds on expect= so a request can't make the server do much work parsing it
+const (
+	maxExprLength = 256
+	maxExprDepth  = 16
+)
+
+const codeExpectFailed = "EXPECT_FAILED" // The check worked, but expect= evaluated to false
+
+// expr is a parsed expect= expression, e.g. status==200 && total_ms<500
+type expr interface {
+	eval(vars map[string]any) any
+}
+
+type (
+	exprLiteral struct{ v any }
+	exprVar     struct{ name string }
+	exprNot     struct{ x expr }
+	exprBinary  struct {
+		op   string
+		l, r expr
+	}
+)
+
+func (e exprLiteral) eval(map[string]any) any  { return e.v }
+func (e exprVar) eval(vars map[string]any) any { return vars[e.name] }
+func (e exprNot) eval(vars map[string]any) any { return !truthy(e.x.eval(vars)) }
+func (e exprBinary) eval(vars map[string]any) any {
+	switch e.op {
+	case "&&":
+		return truthy(e.l.eval(vars)) && truthy(e.r.eval(vars))
+	case "||":
+		return truthy(e.l.eval(vars)) || truthy(e.r.eval(vars))
+	}
+	return compare(e.op, e.l.eval(vars), e.r.eval(vars))
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+// compare orders numbers numerically and strings lexically. Mixed or missing
+// operands are only ever unequal.
+func compare(op string, l, r any) bool {
+	switch op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	}
+	if a, ok := l.(float64); ok {
+		if b, ok := r.(float64); ok {
+			switch op {
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	if a, ok := l.(string); ok {
+		if b, ok := r.(string); ok {
+			switch op {
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	return false
+}
+
+// equal compares scalars; objects and arrays are never equal to anything
+func equal(l, r any) bool {
+	switch l.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	switch r.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return l == r
+}
+
+// parseExpr parses the expect= syntax: field names, numbers, 'strings', true/false,
+// comparisons (== != < <= > >=), !, && and || with parentheses
+func parseExpr(s string) (expr, error) {
+	if len(s) > maxExprLength {
+		return nil, fmt.Errorf("expect is longer than %d characters", maxExprLength)
+	}
+	toks, offs, err := lexExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks, offs: offs}
+	e, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, p.unexpected(p.pos)
+	}
+	return e, nil
+}
+
+// lexExpr splits s into tokens and returns the offset of each in s
+func lexExpr(s string) (toks []string, offs []int, err error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == ' ' || c == '\t' {
+			i++
+			continue
+		}
+		offs = append(offs, i)
+		switch {
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||") ||
+			strings.HasPrefix(s[i:], "==") || strings.HasPrefix(s[i:], "!=") ||
+			strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">="):
+			toks = append(toks, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("<>!()", rune(c)):
+			toks = append(toks, s[i:i+1])
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unterminated string at position %d in expect", i+1)
+			}
+			toks = append(toks, s[i:i+end+2])
+			i += end + 2
+		case isExprWordByte(c):
+			j := i
+			for j < len(s) && isExprWordByte(s[j]) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			return nil, nil, fmt.Errorf("unexpected %q at position %d in expect", c, i+1)
+		}
+	}
+	return toks, offs, nil
+}
+
+func isExprWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+type exprParser struct {
+	toks []string
+	offs []int // Offset of each token in the expression
+	pos  int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+// unexpected reports token i with its position, counted from 1
+func (p *exprParser) unexpected(i int) error {
+	return fmt.Errorf("unexpected %q at position %d in expect", p.toks[i], p.offs[i]+1)
+}
+
+func (p *exprParser) or(depth int) (expr, error) {
+	return p.binary(depth, "||", p.and)
+}
+
+func (p *exprParser) and(depth int) (expr, error) {
+	return p.binary(depth, "&&", p.comparison)
+}
+
+func (p *exprParser) binary(depth int, op string, next func(int) (expr, error)) (expr, error) {
+	l, err := next(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == op {
+		p.pos++
+		r, err := next(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *exprParser) comparison(depth int) (expr, error) {
+	l, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.pos++
+		r, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return exprBinary{op: op, l: l, r: r}, nil
+	}
+	return l, nil
+}
+
+func (p *exprParser) unary(depth int) (expr, error) {
+	if depth > maxExprDepth {
+		return nil, fmt.Errorf("expect is nested more than %d levels", maxExprDepth)
+	}
+	tok := p.peek()
+	if tok == "" {
+		return nil, fmt.Errorf("expect ends unexpectedly")
+	}
+	p.pos++
+
+	switch {
+	case tok == "!":
+		x, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{x: x}, nil
+	case tok == "(":
+		e, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == "" {
+			return nil, fmt.Errorf("missing ) in expect")
+		}
+		if p.peek() != ")" {
+			return nil, p.unexpected(p.pos)
+		}
+		p.pos++
+		return e, nil
+	case tok[0] == '\'' || tok[0] == '"':
+		return exprLiteral{v: tok[1 : len(tok)-1]}, nil
+	case tok == "true" || tok == "false":
+		return exprLiteral{v: tok == "true"}, nil
+	case isExprWordByte(tok[0]):
+		if n, err := strconv.ParseFloat(tok, 64); err == nil {
+			return exprLiteral{v: n}, nil
+		}
+		return exprVar{name: tok}, nil
+	}
+	return nil, p.unexpected(p.pos - 1)
+}
+
+// expectExpr parses the expect param, nil when it's unset. Methods with their own
+// expect param (banner) keep it.
+func (p checkParams) expectExpr(m methodInfo) (expr, error) {
+	s := p.Get("expect")
+	if s == "" || m.hasParam("expect") {
+		return nil, nil
+	}
+	e, err := parseExpr(s)
+	if err != nil {
+		return nil, paramError{err.Error()}
+	}
+	return e, nil
+}
+
+// exprVars exposes a response to expect=: up, error_code and proto, the result as
+// result, and the fields of an object result by their JSON names (nested with dots).
+// A plain HTTP status is also available as status.
+func exprVars(resp Response) map[string]any {
+	vars := map[string]any{"up": resp.Up, "error_code": resp.ErrorCode, "proto": resp.Proto}
+	if s, ok := resp.Result.(statusResult); ok {
+		vars["status"] = float64(s.status)
+	}
+
+	b, err := json.Marshal(resp.Result)
+	if err != nil {
+		return vars
+	}
+	var result any
+	if json.Unmarshal(b, &result) != nil {
+		return vars
+	}
+	vars["result"] = result
+	flattenVars(vars, "", result)
+	return vars
+}
+
+func flattenVars(vars map[string]any, prefix string, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			flattenVars(vars, prefix+k+".", x)
+		}
+	case []any:
+		for i, x := range v {
+			flattenVars(vars, prefix+strconv.Itoa(i)+".", x)
+		}
+	default:
+		if prefix != "" {
+			vars[strings.TrimSuffix(prefix, ".")] = v
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]any{"t": true, "f": false, "status": 200.0, "total_ms": 120.5, "proto": "HTTP/2.0", "body.ok": true}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// && binds tighter than ||, ! tighter than both
+		{"t || f && f", true},
+		{"(t || f) && f", false},
+		{"f && f || t", true},
+		{"!f && t", true},
+		{"!(t && f)", true},
+		{"!t || t", true},
+		{"!!t", true},
+
+		{"status == 200", true},
+		{"status != 200", false},
+		{"status < 300", true},
+		{"status <= 200", true},
+		{"status > 200", false},
+		{"status >= 200", true},
+		{"total_ms < 500 && status == 200", true},
+		{"proto == 'HTTP/2.0'", true},
+		{"proto == \"HTTP/2.0\"", true},
+		{"proto < 'HTTP/3'", true},
+		{"body.ok == true", true},
+		{"status == -1", false},
+
+		// Mixed or missing operands are only ever unequal
+		{"status == '200'", false},
+		{"status != '200'", true},
+		{"status < '300'", false},
+		{"missing == 0", false},
+		{"missing", false},
+		{"missing != 0", true},
+	}
+	for _, tt := range tests {
+		e, err := parseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := truthy(e.eval(vars)); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []struct{ expr, want string }{
+		{"status == 200 )", `unexpected ")" at position 15 in expect`},
+		{"status == == 200", `unexpected "==" at position 11 in expect`},
+		{"(status == 200 total_ms", `unexpected "total_ms" at position 16 in expect`},
+		{"status # 200", `unexpected '#' at position 8 in expect`},
+		{"proto == 'h2", "unterminated string at position 10 in expect"},
+		{"(status == 200", "missing ) in expect"},
+		{"status ==", "expect ends unexpectedly"},
+		{"", "expect ends unexpectedly"},
+		{"!!!!!!!!!!!!!!!!!t", "expect is nested more than 16 levels"},
+	}
+	for _, tt := range tests {
+		_, err := parseExpr(tt.expr)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parseExpr(%q) error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// FTPResult is the result of method=ftp
+type FTPResult struct {
+	ConnectMs float64 `json:"connect_ms"`
+	Banner    string  `json:"banner"` // Text of the 220 greeting
+	LoggedIn  bool    `json:"logged_in"`
+	LoginMs   float64 `json:"login_ms"` // From USER to the final login reply
+	Reply     string  `json:"reply"`    // Last reply of the login, e.g. "530 Login incorrect."
+}
+
+// Up requires a successful login
+func (r FTPResult) Up() bool { return r.LoggedIn }
+
+// ftpChecker logs in on an FTP control connection, anonymously unless user is given
+type ftpChecker struct{}
+
+type ftpOptions struct {
+	tcpOptions
+	User     string
+	Password string
+}
+
+func parseFTPOptions(p checkParams) (ftpOptions, error) {
+	opts := ftpOptions{User: p.Get("user"), Password: p.Get("password")}
+	if opts.User == "" {
+		opts.User = "anonymous"
+		if opts.Password == "" {
+			opts.Password = "pinger@"
+		}
+	}
+	if strings.ContainsAny(opts.User+opts.Password, "\r\n") {
+		return opts, paramErrorf("user and password can't contain line breaks")
+	}
+
+	var err error
+	if opts.Dialer, err = p.Dialer(); err != nil {
+		return opts, err
+	}
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// ftpAddress is host:port, port 21 unless given
+func ftpAddress(p checkParams) string {
+	port := p.Get("port")
+	if port == "" {
+		if _, hostPort, _ := splitTarget(p.Host); hostPort == "" {
+			port = "21"
+		}
+	}
+	addr, _ := tcpAddress(strings.TrimPrefix(p.Host, "ftp://"), port)
+	return addr
+}
+
+func (ftpChecker) Validate(p checkParams) error {
+	_, err := parseFTPOptions(p)
+	return err
+}
+
+func (ftpChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseFTPOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	return checkFTP(ctx, ftpAddress(p), opts)
+}
+
+func checkFTP(ctx context.Context, addr string, opts ftpOptions) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = directDialer
+	}
+	start := time.Now()
+	conn, err := dialTimeout(ctx, dialer, "tcp", addr, opts.ConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	res := FTPResult{ConnectMs: durationMs(time.Since(start))}
+
+	// The deadline covers the whole conversation, closing on cancel unblocks a pending read
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	tp := textproto.NewConn(conn)
+	_, msg, err := tp.ReadResponse(220)
+	if err != nil {
+		return 0, ftpError(ctx, "greeting", err)
+	}
+	res.Banner = msg
+
+	loginStart := time.Now()
+	code, msg, err := ftpCommand(tp, "USER "+opts.User)
+	if err == nil && code == 331 {
+		code, msg, err = ftpCommand(tp, "PASS "+opts.Password)
+	}
+	if err != nil {
+		return 0, ftpError(ctx, "login", err)
+	}
+	res.LoginMs = durationMs(time.Since(loginStart))
+	res.Reply = fmt.Sprintf("%d %s", code, msg)
+	res.LoggedIn = code == 230 || code == 202
+
+	ftpCommand(tp, "QUIT") // Best effort, the answer doesn't matter
+	return res, nil
+}
+
+// ftpCommand sends cmd and reads the reply, whatever its code
+func ftpCommand(tp *textproto.Conn, cmd string) (int, string, error) {
+	if err := tp.PrintfLine("%s", cmd); err != nil {
+		return 0, "", err
+	}
+	return tp.ReadResponse(0)
+}
+
+// ftpError names the step that failed; a step cut off by the timeout is a READ_TIMEOUT
+func ftpError(ctx context.Context, step string, err error) error {
+	err = fmt.Errorf("ftp %s failed: %w", step, err)
+	if ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		return &checkError{code: codeReadTimeout, err: err}
+	}
+	return err
+}
@@ -1,3 +1,25 @@
 module github.com/fedorananin/pinger
 
 go 1.21
+
+require golang.org/x/net v0.34.0
+
+require github.com/andybalholm/brotli v1.1.1
+
+require github.com/gorilla/websocket v1.5.3
+
+require (
+	github.com/quic-go/quic-go v0.42.0
+	golang.org/x/sys v0.29.0
+)
+
+require (
+	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38 // indirect
+	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
+	go.uber.org/mock v0.4.0 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/exp v0.0.0-20221205204356-47842c84f3db // indirect
+	golang.org/x/mod v0.11.0 // indirect
+	golang.org/x/tools v0.9.1 // indirect
+)
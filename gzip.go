@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Response compression (COMPRESS_RESPONSES, COMPRESS_MIN_BYTES). Smaller bodies are sent
+// as they are, gzip wouldn't save anything worth the CPU.
+var (
+	compressResponses = true
+	compressMinBytes  = 1024
+)
+
+// acceptsGzip reports whether the client listed gzip (or *) in Accept-Encoding without q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if name = strings.TrimSpace(name); name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponses compresses responses for clients that accept gzip once they reach compressMinBytes
+func gzipResponses(next http.Handler) http.Handler {
+	if !compressResponses {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipWriter holds back the start of the body until it knows whether it's worth compressing
+type gzipWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	flushed bool // Headers and anything buffered went out uncompressed
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.flushed:
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf.Write(b)
+	if w.buf.Len() >= compressMinBytes {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// startGzip sends the headers with Content-Encoding and compresses what's buffered
+func (w *gzipWriter) startGzip() error {
+	h := w.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// sendPlain sends the headers and the buffered body uncompressed
+func (w *gzipWriter) sendPlain() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	w.flushed = true
+}
+
+// Flush of a stream (NDJSON batches) commits to gzip, a stream is rarely small
+func (w *gzipWriter) Flush() {
+	if w.gz == nil && !w.flushed {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.startGzip()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend write deadlines
+func (w *gzipWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// finish sends a short body as is, or ends the gzip stream
+func (w *gzipWriter) finish() {
+	switch {
+	case w.gz != nil:
+		w.gz.Close()
+	case !w.flushed && w.status != 0:
+		w.sendPlain()
+	}
+}
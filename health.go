@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ready is true while the server accepts traffic. It is set once startup is
+// done and cleared as soon as shutdown begins.
+var ready atomic.Bool
+
+// How long /ready reports 503 before the listener closes, so load balancers can drain
+const readyDrainDelay = 5 * time.Second
+
+// How long in-flight checks may take to finish during shutdown (SHUTDOWN_TIMEOUT).
+// Long enough for the longest sustained ping by default.
+var shutdownTimeout = maxPingDuration + writeTimeout
+
+// handleHealthz is the liveness probe: the process is up and serving HTTP
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// handleReady is the readiness probe: 503 before startup completes and during shutdown
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"not ready"}` + "\n"))
+		return
+	}
+	w.Write([]byte(`{"status":"ready"}` + "\n"))
+}
+
+// serve runs the server until SIGINT/SIGTERM, then marks it not ready, waits for
+// load balancers to notice and shuts down gracefully.
+func serve(server *http.Server) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Parent of every request context, cancelled to stop checks still running when time is up
+	baseCtx, cancelChecks := context.WithCancel(context.Background())
+	defer cancelChecks()
+	server.BaseContext = func(net.Listener) context.Context { return baseCtx }
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.ListenAndServe()
+	}()
+	ready.Store(true)
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down, draining for %s", readyDrainDelay)
+	ready.Store(false)
+	time.Sleep(readyDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		_, running := concurrencyLimit.stats()
+		log.Printf("WARNING: shutdown timeout of %s reached, cancelling %d running checks", shutdownTimeout, running)
+		cancelChecks()
+		server.Close()
+		return
+	}
+	log.Println("Server stopped")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter keeps a semaphore per target host
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem      chan struct{}
+	lastUsed time.Time
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit: limit,
+		hosts: make(map[string]*hostSlot),
+	}
+}
+
+// hostKey normalizes a target so "Example.com" and "https://example.com" share a slot
+func hostKey(host string) string {
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	return strings.ToLower(host)
+}
+
+// acquire takes a slot for host without blocking. ok is false when the host is saturated.
+func (l *hostLimiter) acquire(host string) (release func(), ok bool) {
+	key := hostKey(host)
+
+	l.mu.Lock()
+	slot, exists := l.hosts[key]
+	if !exists {
+		slot = &hostSlot{sem: make(chan struct{}, l.limit)}
+		l.hosts[key] = slot
+	}
+	slot.lastUsed = time.Now()
+	l.mu.Unlock()
+
+	select {
+	case slot.sem <- struct{}{}:
+		return func() { <-slot.sem }, true
+	default:
+		return nil, false
+	}
+}
+
+// cleanupLoop periodically drops slots that have been idle for a full interval
+func (l *hostLimiter) cleanupLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.cleanup(interval)
+	}
+}
+
+func (l *hostLimiter) cleanup(maxIdle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxIdle)
+	for key, slot := range l.hosts {
+		// Only remove entries with no checks in flight
+		if len(slot.sem) == 0 && slot.lastUsed.Before(cutoff) {
+			delete(l.hosts, key)
+		}
+	}
+}
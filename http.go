@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shared transport so repeated checks against the same host reuse connections
+// instead of paying for a new TCP/TLS handshake every time.
+// Options that need different TLS settings should Clone() it rather than modify it.
+var httpTransport = &http.Transport{
+	DialContext:         transportDial(directDialer),
+	ForceAttemptHTTP2:   true,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 5 * time.Second,
+}
+
+// connectTimeoutKey carries a per-request connect_timeout to the shared transport's dialer
+type connectTimeoutKey struct{}
+
+// transportDial adapts d for http.Transport, applying the connect timeout found in ctx
+func transportDial(d contextDialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration)
+		if !ok {
+			timeout = defaultCheckTimeout
+		}
+		return dialTimeout(ctx, d, network, addr, timeout)
+	}
+}
+
+var httpClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: httpTransport,
+}
+
+// Most redirects an HTTP check follows (MAX_REDIRECTS), also the ceiling for max_redirects
+var maxRedirects = 10
+
+const codeTooManyRedirects = "TOO_MANY_REDIRECTS" // The redirect chain is longer than max_redirects
+
+// Cap on the request body sent by HTTP checks
+const maxHTTPCheckBody = 64 << 10
+
+// Most of the response body a timing=true check reads before stopping the clock
+const maxTimingBody = 16 << 20
+
+var allowedHTTPMethods = map[string]bool{
+	"HEAD": true, "GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// httpOptions controls the request sent by checkHTTP
+type httpOptions struct {
+	Method      string // Defaults to HEAD
+	Body        []byte
+	ContentType string
+	Dialer      contextDialer // Non-nil when the check goes through a proxy
+
+	ResolveTiming    bool             // Report DNS time separately (resolve_timing=true)
+	Timing           bool             // Report time to first byte and read the body for total_ms (timing=true)
+	CheckCompression bool             // Offer gzip/br and report the encoding used (check_compression=true)
+	ReturnHeaders    []string         // Canonical names of response headers to include (return_headers)
+	Insecure         bool             // Skip TLS verification (insecure=true)
+	RequireValidCert bool             // Fail on a bad certificate even when Insecure (require_valid_cert=true)
+	KeepAlive        bool             // Reuse pooled connections; false forces a fresh connect (keepalive=false)
+	ReportReuse      bool             // keepalive was given, so report whether the connection was reused
+	IfModifiedSince  string           // Sent as If-Modified-Since (if_modified_since)
+	IfNoneMatch      string           // Sent as If-None-Match (if_none_match)
+	ExpectJSON       *jsonExpectation // Body must be JSON (expect_json=true, json_field, json_value)
+	MaxRedirects     int              // Redirects to follow, 0 returns the first 3xx (max_redirects)
+	BackendSamples   int              // Extra requests counting which backend answers (backend_samples)
+	BackendHeader    string           // Response header naming the backend, instead of its IP (backend_header)
+	SecurityHeaders  bool             // Grade the security headers (check_security_headers=true)
+	TraceCNAME       bool             // Report the CNAME chain of the host (trace_cname=true)
+	TCPInfo          bool             // Read TCP_INFO of the connection after a throughput download (tcp_info=true)
+	Samples          int              // Time this many requests in all and report percentiles (samples)
+	SLOP95Ms         float64          // With Samples, p95 latency the check must stay within (slo_p95_ms)
+	HTTP2            bool             // Offer h2 via ALPN and warn when the server falls back (http2=true)
+	BodyBounds       *bodyBounds      // Allowed body length (min_body_bytes, max_body_bytes)
+	Expect           bool             // A rule over the result is given (expect), so it needs total_ms
+
+	Timeout        time.Duration // Whole request (timeout)
+	ConnectTimeout time.Duration // Just the connection setup (connect_timeout)
+}
+
+// wantsDetails reports whether the result is an HTTPResult rather than the plain status.
+// Every option that adds a field to the result has to be listed here.
+func (o httpOptions) wantsDetails() bool {
+	switch {
+	case o.ResolveTiming, o.Timing, o.CheckCompression, o.ReportReuse, o.SecurityHeaders, o.TraceCNAME, o.HTTP2, o.Expect:
+		return true
+	case len(o.ReturnHeaders) > 0, o.BackendSamples > 0, o.Samples > 0, o.BodyBounds != nil:
+		return true
+	case o.IfModifiedSince != "" || o.IfNoneMatch != "": // The conditional part
+		return true
+	}
+	return false
+}
+
+// parseHTTPOptions reads http_method, body and content_type.
+// Without a body param, the body of a POST to the pinger itself is passed through.
+func parseHTTPOptions(p checkParams) (httpOptions, error) {
+	opts := httpOptions{
+		Method:      "HEAD",
+		ContentType: p.Get("content_type"),
+	}
+
+	if m := strings.ToUpper(p.Get("http_method")); m != "" {
+		if !allowedHTTPMethods[m] {
+			return opts, paramErrorf("unsupported http_method %q", m)
+		}
+		opts.Method = m
+	}
+
+	if p.Query.Has("body") {
+		opts.Body = []byte(p.Get("body"))
+	} else if len(p.Body) > 0 {
+		opts.Body = p.Body
+		if opts.ContentType == "" {
+			opts.ContentType = p.BodyType
+		}
+	}
+	if len(opts.Body) > maxHTTPCheckBody {
+		return opts, paramErrorf("body exceeds %d bytes", maxHTTPCheckBody)
+	}
+	opts.CheckCompression = p.Get("check_compression") == "true"
+	if p.Get("expect_json") == "true" || p.Get("json_field") != "" {
+		if opts.CheckCompression {
+			return opts, paramErrorf("expect_json can't be combined with check_compression")
+		}
+		opts.ExpectJSON = &jsonExpectation{Field: p.Get("json_field"), Value: p.Get("json_value"), HasValue: p.Query.Has("json_value")}
+	} else if p.Query.Has("json_value") {
+		return opts, paramErrorf("json_value needs json_field")
+	}
+	bounds, err := parseBodyBounds(p)
+	if err != nil {
+		return opts, err
+	}
+	if bounds != nil && (opts.CheckCompression || opts.ExpectJSON != nil) {
+		return opts, paramErrorf("min_body_bytes and max_body_bytes can't be combined with check_compression or expect_json")
+	}
+	opts.BodyBounds = bounds
+	if p.Get("http_method") == "" {
+		// A body implies POST, and measuring compression, checking JSON or the body size needs a body back, unless a method was given explicitly
+		if len(opts.Body) > 0 {
+			opts.Method = "POST"
+		} else if opts.CheckCompression || opts.ExpectJSON != nil || opts.BodyBounds != nil {
+			opts.Method = "GET"
+		}
+	} else if opts.BodyBounds != nil && opts.Method == "HEAD" {
+		return opts, paramErrorf("min_body_bytes and max_body_bytes need a method with a response body, not HEAD")
+	}
+
+	for _, name := range strings.Split(p.Get("return_headers"), ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name != "" && !redactedHeaders[name] {
+			opts.ReturnHeaders = append(opts.ReturnHeaders, name)
+		}
+	}
+
+	if s := p.Get("if_modified_since"); s != "" {
+		if _, err := http.ParseTime(s); err != nil {
+			return opts, paramErrorf("if_modified_since must be an HTTP date, e.g. %s", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+		}
+		opts.IfModifiedSince = s
+	}
+	opts.IfNoneMatch = p.Get("if_none_match")
+
+	opts.MaxRedirects = maxRedirects
+	if s := p.Get("max_redirects"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > maxRedirects {
+			return opts, paramErrorf("max_redirects must be between 0 and %d", maxRedirects)
+		}
+		opts.MaxRedirects = n
+	}
+
+	dialer, err := p.Dialer()
+	if err != nil {
+		return opts, err
+	}
+	opts.Dialer = dialer
+
+	if s := p.Get("backend_samples"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxBackendSamples {
+			return opts, paramErrorf("backend_samples must be between 1 and %d", maxBackendSamples)
+		}
+		opts.BackendSamples = n
+	}
+	if s := p.Get("samples"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxHTTPSamples {
+			return opts, paramErrorf("samples must be between 1 and %d", maxHTTPSamples)
+		}
+		opts.Samples = n
+	}
+	if s := p.Get("slo_p95_ms"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 || math.IsInf(v, 0) {
+			return opts, paramErrorf("slo_p95_ms must be a positive number of milliseconds")
+		}
+		if opts.Samples == 0 {
+			return opts, paramErrorf("slo_p95_ms needs samples")
+		}
+		opts.SLOP95Ms = v
+	}
+	opts.BackendHeader = http.CanonicalHeaderKey(p.Get("backend_header"))
+	if opts.BackendSamples > 0 && opts.BackendHeader == "" && dialer != nil {
+		return opts, paramErrorf("through a proxy backend_samples needs backend_header, the address seen is the proxy's")
+	}
+	opts.ResolveTiming = p.Get("resolve_timing") == "true"
+	opts.Timing = p.Get("timing") == "true"
+	opts.SecurityHeaders = p.Get("check_security_headers") == "true"
+	opts.TraceCNAME = p.Get("trace_cname") == "true"
+	opts.HTTP2 = p.Get("http2") == "true"
+	opts.Expect = p.Get("expect") != ""
+	opts.Insecure = p.Get("insecure") == "true"
+	opts.RequireValidCert = p.Get("require_valid_cert") == "true"
+	opts.KeepAlive = p.Get("keepalive") != "false"
+	opts.ReportReuse = p.Get("keepalive") != ""
+
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// httpChecker requests scheme://host
+type httpChecker struct {
+	scheme string
+}
+
+func (c httpChecker) Validate(p checkParams) error {
+	_, err := c.options(p)
+	return err
+}
+
+func (c httpChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := c.options(p)
+	if err != nil {
+		return 0, err
+	}
+	return checkHTTP(ctx, p.Host, c.scheme, opts)
+}
+
+func (c httpChecker) options(p checkParams) (httpOptions, error) {
+	opts, err := parseHTTPOptions(p)
+	if err == nil && opts.HTTP2 && c.scheme != "https" {
+		return opts, paramErrorf("http2 needs method=https, ALPN is part of the TLS handshake")
+	}
+	return opts, err
+}
+
+// httpStatus is an HTTP status code
+type httpStatus int
+
+// Up treats anything below 400 (including redirects) as a working site
+func (s httpStatus) Up() bool { return s > 0 && s < 400 }
+
+// protoReporter is implemented by results of HTTP checks, the protocol goes into the response's proto
+type protoReporter interface {
+	Proto() string
+}
+
+// statusResult is the plain result of checkHTTP. It encodes as the bare status code.
+type statusResult struct {
+	status httpStatus
+	proto  string
+}
+
+func (r statusResult) Up() bool                     { return r.status.Up() }
+func (r statusResult) Proto() string                { return r.proto }
+func (r statusResult) String() string               { return strconv.Itoa(int(r.status)) }
+func (r statusResult) MarshalJSON() ([]byte, error) { return json.Marshal(int(r.status)) }
+
+// HTTPResult replaces the plain status code when details are requested
+type HTTPResult struct {
+	Status  int      `json:"status"`
+	DNSMs   *float64 `json:"dns_ms,omitempty"`  // Omitted for IP literals, proxied checks and reused connections
+	TTFBMs  *float64 `json:"ttfb_ms,omitempty"` // With timing=true
+	TotalMs float64  `json:"total_ms"`          // Until the body was read with timing=true, otherwise until the headers
+
+	Compression *CompressionResult `json:"compression,omitempty"` // With check_compression=true
+	Headers     map[string]string  `json:"headers,omitempty"`     // With return_headers; missing headers are left out
+	Reused      *bool              `json:"reused,omitempty"`      // Whether a pooled connection was used, with keepalive
+	Conditional *ConditionalResult `json:"conditional,omitempty"` // With if_modified_since or if_none_match
+
+	SecurityHeaders *SecurityHeadersResult `json:"security_headers,omitempty"` // With check_security_headers=true
+	Backends        *BackendDistribution   `json:"backends,omitempty"`         // With backend_samples
+	CNAME           *CNAMETrace            `json:"cname_chain,omitempty"`      // With trace_cname=true, omitted for IP literals
+	Latency         *LatencySamples        `json:"latency,omitempty"`          // With samples
+	BodyBytes       *int64                 `json:"body_bytes,omitempty"`       // With min_body_bytes or max_body_bytes
+	HTTP2           *HTTP2Result           `json:"http2,omitempty"`            // With http2=true
+
+	proto string
+}
+
+// ConditionalResult tells whether a conditional request was answered with 304
+type ConditionalResult struct {
+	NotModified  bool   `json:"not_modified"`
+	LastModified string `json:"last_modified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+}
+
+// HTTP2Result compares the protocols offered and negotiated via ALPN (http2=true)
+type HTTP2Result struct {
+	Requested  string `json:"requested"`  // Always h2, with http/1.1 as the fallback
+	Negotiated string `json:"negotiated"` // What the server (or a middlebox in between) picked
+	Downgraded bool   `json:"downgraded"`
+}
+
+// Up also needs a met latency SLO, when slo_p95_ms was given
+func (r HTTPResult) Up() bool {
+	return httpStatus(r.Status).Up() && (r.Latency == nil || r.Latency.SLOMet == nil || *r.Latency.SLOMet)
+}
+
+func (r HTTPResult) Proto() string { return r.proto }
+
+// httpTiming is filled from httptrace hooks, which may fire on the transport's dial goroutine
+type httpTiming struct {
+	mu        sync.Mutex
+	dnsStart  time.Time
+	dns       time.Duration
+	connected bool
+	reused    bool
+	firstByte time.Time
+	netConn   net.Conn
+}
+
+func (t *httpTiming) gotConn() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected
+}
+
+// conn is the connection the request went out on, nil before GotConn
+func (t *httpTiming) conn() net.Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.netConn
+}
+
+func (t *httpTiming) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.connected = true
+			t.reused = info.Reused
+			t.netConn = info.Conn
+			t.mu.Unlock()
+		},
+	}
+}
+
+func checkHTTP(ctx context.Context, host, scheme string, opts httpOptions) (any, error) {
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimPrefix(host, "https://")
+
+	url := targetURL(scheme, host)
+
+	var body io.Reader
+	if len(opts.Body) > 0 {
+		body = bytes.NewReader(opts.Body)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, connectTimeoutKey{}, opts.ConnectTimeout)
+
+	timing := &httpTiming{}
+	ctx = httptrace.WithClientTrace(ctx, timing.trace())
+
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, opts.Method, url, body)
+	if err != nil {
+		return 0, err
+	}
+	if opts.ContentType != "" {
+		req.Header.Set("Content-Type", opts.ContentType)
+	}
+	if opts.CheckCompression {
+		// Setting it ourselves also stops the transport from transparently decompressing
+		req.Header.Set("Accept-Encoding", compressionAcceptEncoding)
+	}
+	if opts.IfModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", opts.IfModifiedSince)
+	}
+	if opts.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", opts.IfNoneMatch)
+	}
+	conditional := opts.IfModifiedSince != "" || opts.IfNoneMatch != ""
+
+	client, done := checkClient(opts)
+	defer done()
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, classifyHTTPError(err, timing.gotConn())
+	}
+	defer resp.Body.Close()
+
+	if opts.RequireValidCert && opts.Insecure && resp.TLS != nil {
+		if err := verifyPeerCert(resp.TLS, req.URL.Hostname()); err != nil {
+			return 0, err
+		}
+	}
+
+	if opts.ExpectJSON != nil && httpStatus(resp.StatusCode).Up() {
+		// A down status already tells what's wrong, its error page needn't be JSON
+		if err := checkJSONBody(resp.Body, *opts.ExpectJSON); err != nil {
+			return 0, err
+		}
+	}
+
+	var bodyBytes int64
+	if opts.BodyBounds != nil && httpStatus(resp.StatusCode).Up() {
+		// Like expect_json, only a working status is expected to have the right size
+		if bodyBytes, err = checkBodySize(resp.Body, *opts.BodyBounds); err != nil {
+			if errorCode(err) == "" {
+				err = classifyHTTPError(err, true)
+			}
+			return 0, err
+		}
+	}
+
+	if !opts.wantsDetails() {
+		return statusResult{status: httpStatus(resp.StatusCode), proto: resp.Proto}, nil
+	}
+
+	res := HTTPResult{Status: resp.StatusCode, proto: resp.Proto}
+	if opts.BodyBounds != nil && httpStatus(resp.StatusCode).Up() {
+		res.BodyBytes = &bodyBytes
+	}
+	for _, name := range opts.ReturnHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			if res.Headers == nil {
+				res.Headers = make(map[string]string)
+			}
+			res.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+	if conditional {
+		res.Conditional = &ConditionalResult{
+			NotModified:  resp.StatusCode == http.StatusNotModified,
+			LastModified: resp.Header.Get("Last-Modified"),
+			ETag:         resp.Header.Get("ETag"),
+		}
+	}
+	if opts.SecurityHeaders {
+		res.SecurityHeaders = auditSecurityHeaders(resp.Header, resp.TLS != nil)
+	}
+	if opts.CheckCompression {
+		res.Compression = measureCompression(resp.Header.Get("Content-Encoding"), resp.Body)
+	}
+	if opts.Timing {
+		// Whatever compression didn't read, so total_ms covers the whole transfer
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxTimingBody))
+	}
+	res.TotalMs = durationMs(time.Since(start))
+	timing.mu.Lock()
+	if opts.Timing && !timing.firstByte.IsZero() {
+		ttfb := durationMs(timing.firstByte.Sub(start))
+		res.TTFBMs = &ttfb
+	}
+	// Only direct connections: through a proxy the hooks time the proxy's name, not the target's
+	if opts.ResolveTiming && !timing.dnsStart.IsZero() && opts.Dialer == nil {
+		dns := durationMs(timing.dns)
+		res.DNSMs = &dns
+	}
+	if opts.ReportReuse {
+		reused := timing.reused
+		res.Reused = &reused
+	}
+	timing.mu.Unlock()
+	var sampleErr error
+	if opts.Samples > 0 {
+		res.Latency, sampleErr = sampleLatency(ctx, url, opts, res.TotalMs, opts.Samples)
+	}
+	if opts.BackendSamples > 0 {
+		// Once the check's own request is measured, as these samples also fire its trace hooks
+		res.Backends = sampleBackends(ctx, url, opts, opts.BackendSamples)
+	}
+	if opts.TraceCNAME && net.ParseIP(req.URL.Hostname()) == nil {
+		// The system's nameserver, even for proxied checks: the proxy may resolve differently
+		res.CNAME = traceCNAME(ctx, req.URL.Hostname())
+	}
+	if opts.HTTP2 && resp.TLS != nil {
+		res.HTTP2 = &HTTP2Result{Requested: "h2", Negotiated: resp.TLS.NegotiatedProtocol}
+		if res.HTTP2.Negotiated == "" {
+			res.HTTP2.Negotiated = "http/1.1" // No ALPN at all, the server only speaks HTTP/1.1
+		}
+		res.HTTP2.Downgraded = res.HTTP2.Negotiated != "h2"
+		if res.HTTP2.Downgraded && sampleErr == nil {
+			return res, warningError{msg: fmt.Sprintf("downgraded: h2 was offered but %s was negotiated, a proxy or load balancer may strip HTTP/2", res.HTTP2.Negotiated)}
+		}
+	}
+	return res, sampleErr
+}
+
+// checkClient returns the client for a check; done releases its connections.
+// Deadlines come from ctx, not Client.Timeout, so timeouts can be classified.
+func checkClient(opts httpOptions) (client *http.Client, done func()) {
+	if opts.Dialer == nil && !opts.Insecure && opts.KeepAlive {
+		return &http.Client{Transport: httpTransport, CheckRedirect: redirectPolicy(opts.MaxRedirects)}, func() {}
+	}
+
+	// Proxied and insecure checks get their own transport so their connections
+	// aren't pooled with direct, verified ones; keepalive=false must not touch the warm pool
+	transport := httpTransport.Clone()
+	transport.DisableKeepAlives = !opts.KeepAlive
+	if opts.Dialer != nil {
+		transport.DialContext = transportDial(opts.Dialer)
+	}
+	if opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{RootCAs: trustedRoots, InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport, CheckRedirect: redirectPolicy(opts.MaxRedirects)}, transport.CloseIdleConnections
+}
+
+// redirectPolicy follows up to limit redirects; with 0 the redirect itself is the result
+func redirectPolicy(limit int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if limit == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > limit {
+			return &checkError{code: codeTooManyRedirects, err: fmt.Errorf("too many redirects: followed %d (max_redirects), the next went to %s", len(via)-1, req.URL.Redacted())}
+		}
+		return nil
+	}
+}
+
+// classifyHTTPError adds an error code: a timeout before a connection was made is a
+// CONNECT_TIMEOUT, one after it (server accepted but didn't answer) is a READ_TIMEOUT
+func classifyHTTPError(err error, connected bool) error {
+	if code := errorCode(err); code != "" {
+		return &checkError{code: code, err: err}
+	}
+	if ce := certError(err); ce != nil {
+		return ce
+	}
+
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		if connected {
+			return &checkError{code: codeReadTimeout, err: err}
+		}
+		return &checkError{code: codeConnectTimeout, err: err}
+	}
+	return proxyError(err)
+}
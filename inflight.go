@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// inflightLimiter counts the requests each client IP has in flight (MAX_INFLIGHT_PER_IP).
+// Unlike the rate limit it doesn't care how often a client asks, only how much it holds at once.
+type inflightLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	counts map[string]int // Entries are removed when they drop to zero
+}
+
+var clientInflightLimit *inflightLimiter // nil when MAX_INFLIGHT_PER_IP is unset or 0
+
+func newInflightLimiter(limit int) *inflightLimiter {
+	return &inflightLimiter{limit: limit, counts: make(map[string]int)}
+}
+
+// acquire counts a request for ip without blocking. ok is false when ip is at the limit.
+func (l *inflightLimiter) acquire(ip string) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip] >= l.limit {
+		return nil, false
+	}
+	l.counts[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.counts[ip]--; l.counts[ip] <= 0 {
+				delete(l.counts, ip)
+			}
+		})
+	}, true
+}
+
+// limitInflight answers 429 to clients that already have MAX_INFLIGHT_PER_IP requests running
+func limitInflight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientInflightLimit == nil || r.URL.Path == "/healthz" || r.URL.Path == "/ready" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, ok := clientInflightLimit.acquire(clientIP(r))
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "Too many requests in flight from this client, wait for one to finish")
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Checked by method=internet unless INTERNET_ANCHORS says otherwise
+const defaultInternetAnchors = "tcp:8.8.8.8:53,tcp:1.1.1.1:53,https:www.google.com"
+
+// internetAnchor is one well-known target, written as method:host in INTERNET_ANCHORS
+type internetAnchor struct {
+	Method string
+	Host   string
+}
+
+var internetAnchors []internetAnchor
+
+// parseInternetAnchors reads a comma-separated list like "tcp:1.1.1.1:53,https:example.com"
+func parseInternetAnchors(list string) ([]internetAnchor, error) {
+	var anchors []internetAnchor
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		method, host, ok := strings.Cut(entry, ":")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("anchor %q must be method:host", entry)
+		}
+		if _, known := lookupMethod(method); !known || method == "internet" {
+			return nil, fmt.Errorf("anchor %q has unsupported method %q", entry, method)
+		}
+		anchors = append(anchors, internetAnchor{Method: method, Host: host})
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no anchors")
+	}
+	return anchors, nil
+}
+
+// InternetResult is the result of method=internet
+type InternetResult struct {
+	Verdict   string                 `json:"verdict"` // online, degraded (some anchors failed) or offline
+	Reachable int                    `json:"reachable"`
+	Total     int                    `json:"total"`
+	Anchors   []InternetAnchorResult `json:"anchors"`
+}
+
+// Up when any anchor answered, a single unreachable anchor is more likely its own problem
+func (r InternetResult) Up() bool { return r.Reachable > 0 }
+
+// InternetAnchorResult is the outcome of checking one anchor
+type InternetAnchorResult struct {
+	Method    string `json:"method"`
+	Host      string `json:"host"`
+	Up        bool   `json:"up"`
+	Result    any    `json:"result"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// internetChecker checks all anchors in parallel to tell a broken target from broken connectivity
+type internetChecker struct{}
+
+func (internetChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	res := InternetResult{Total: len(internetAnchors), Anchors: make([]InternetAnchorResult, len(internetAnchors))}
+
+	var wg sync.WaitGroup
+	for i, anchor := range internetAnchors {
+		wg.Add(1)
+		go func(i int, anchor internetAnchor) {
+			defer wg.Done()
+			res.Anchors[i] = checkAnchor(ctx, anchor, p.Get("timeout"))
+		}(i, anchor)
+	}
+	wg.Wait()
+
+	for _, a := range res.Anchors {
+		if a.Up {
+			res.Reachable++
+		}
+	}
+	switch res.Reachable {
+	case res.Total:
+		res.Verdict = "online"
+	case 0:
+		res.Verdict = "offline"
+	default:
+		res.Verdict = "degraded"
+	}
+	return res, nil
+}
+
+func checkAnchor(ctx context.Context, anchor internetAnchor, timeout string) InternetAnchorResult {
+	res := InternetAnchorResult{Method: anchor.Method, Host: anchor.Host, Result: 0}
+	if err := methodEnabled(anchor.Method); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	query := url.Values{"host": {anchor.Host}}
+	if timeout != "" {
+		query.Set("timeout", timeout)
+	}
+	m, _ := lookupMethod(anchor.Method)
+	resp, err := runCheck(ctx, anchor.Method, m, checkParams{Host: anchor.Host, Query: query})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Up, res.Result, res.Error, res.ErrorCode = resp.Up, resp.Result, resp.Error, resp.ErrorCode
+	return res
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	codeInvalidJSON  = "INVALID_JSON"  // expect_json=true but the body didn't parse
+	codeJSONMismatch = "JSON_MISMATCH" // json_field is missing or doesn't have json_value
+)
+
+// Most of the body an expect_json check reads
+const maxJSONBody = 1 << 20
+
+// jsonExpectation is what expect_json, json_field and json_value ask of the body
+type jsonExpectation struct {
+	Field    string // Dot path like data.status or items.0.id, empty to only check the syntax
+	Value    string
+	HasValue bool
+}
+
+// checkJSONBody decodes up to maxJSONBody bytes of body and checks the expected field
+func checkJSONBody(body io.Reader, want jsonExpectation) error {
+	data, err := io.ReadAll(io.LimitReader(body, maxJSONBody+1))
+	if err != nil {
+		return fmt.Errorf("reading body failed: %w", err)
+	}
+	if len(data) > maxJSONBody {
+		return &checkError{code: codeInvalidJSON, err: fmt.Errorf("response body exceeds %d bytes", maxJSONBody)}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return &checkError{code: codeInvalidJSON, err: fmt.Errorf("response is not valid JSON: %v", err)}
+	}
+	if dec.More() {
+		return &checkError{code: codeInvalidJSON, err: fmt.Errorf("response is not valid JSON: data after the top-level value")}
+	}
+	if want.Field == "" {
+		return nil
+	}
+
+	v, ok := jsonLookup(doc, want.Field)
+	if !ok {
+		return &checkError{code: codeJSONMismatch, err: fmt.Errorf("json field %s not found", want.Field)}
+	}
+	if got := jsonScalar(v); want.HasValue && got != want.Value {
+		return &checkError{code: codeJSONMismatch, err: fmt.Errorf("json field %s is %q, expected %q", want.Field, got, want.Value)}
+	}
+	return nil
+}
+
+// jsonLookup follows a dot path through objects and arrays
+func jsonLookup(doc any, path string) (any, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]any:
+			v, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// jsonScalar formats a value for comparison with json_value: strings as they are, anything else as JSON
+func jsonScalar(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Upper bound for samples= on HTTP checks, the requests are sequential and share one timeout
+const maxHTTPSamples = 100
+
+// LatencySamples summarizes repeated requests (samples), judged against slo_p95_ms if given
+type LatencySamples struct {
+	Samples  int      `json:"samples"`
+	Failed   int      `json:"failed"` // Errors, and samples the timeout didn't leave room for
+	MinMs    float64  `json:"min_ms"`
+	P50Ms    float64  `json:"p50_ms"`
+	P95Ms    float64  `json:"p95_ms"`
+	MaxMs    float64  `json:"max_ms"`
+	SLOP95Ms *float64 `json:"slo_p95_ms,omitempty"`
+	SLOMet   *bool    `json:"slo_met,omitempty"` // p95 within the SLO and no sample failed
+}
+
+// sampleLatency times n requests, the check's own request (first) included. Each is
+// timed like total_ms: until the headers, or the whole body with timing=true.
+func sampleLatency(ctx context.Context, url string, opts httpOptions, first float64, n int) (*LatencySamples, error) {
+	client, done := checkClient(opts)
+	defer done()
+
+	latencies := []float64{first}
+	attempted := 1
+	for ; attempted < n && ctx.Err() == nil; attempted++ {
+		if ms, ok := timeRequest(ctx, client, url, opts); ok {
+			latencies = append(latencies, ms)
+		}
+	}
+	sort.Float64s(latencies)
+
+	res := &LatencySamples{
+		Samples: n,
+		Failed:  n - len(latencies),
+		MinMs:   latencies[0],
+		P50Ms:   nearestRank(latencies, 50),
+		P95Ms:   nearestRank(latencies, 95),
+		MaxMs:   latencies[len(latencies)-1],
+	}
+	if opts.SLOP95Ms > 0 {
+		slo := opts.SLOP95Ms
+		met := res.Failed == 0 && res.P95Ms <= slo
+		res.SLOP95Ms, res.SLOMet = &slo, &met
+	}
+	if attempted < n {
+		return res, partialError{&checkError{code: codeTimeout, err: fmt.Errorf("timeout after %d of %d samples", attempted, n)}}
+	}
+	return res, nil
+}
+
+// timeRequest makes one request of a latency sample, false if it failed
+func timeRequest(ctx context.Context, client *http.Client, url string, opts httpOptions) (float64, bool) {
+	req, err := http.NewRequestWithContext(ctx, opts.Method, url, bytes.NewReader(opts.Body))
+	if err != nil {
+		return 0, false
+	}
+	if opts.ContentType != "" {
+		req.Header.Set("Content-Type", opts.ContentType)
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+	if opts.Timing {
+		if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxTimingBody)); err != nil {
+			return 0, false
+		}
+	}
+	return durationMs(time.Since(start)), true
+}
+
+// nearestRank is the pct percentile of sorted, non-empty values by the nearest-rank method
+func nearestRank(sorted []float64, pct float64) float64 {
+	idx := int(math.Ceil(pct/100*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)]
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// logThrottle collapses repeated identical failures of a host in the log (LOG_THROTTLE_INTERVAL):
+// the first is logged, the rest of the interval only counted and reported as a summary
+type logThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	entries  map[string]*throttledLog
+}
+
+type throttledLog struct {
+	method, host, failure string
+	started               time.Time
+	suppressed            int
+}
+
+// nil when LOG_THROTTLE_INTERVAL is unset or 0
+var checkLogThrottle *logThrottle
+
+func newLogThrottle(interval time.Duration) *logThrottle {
+	return &logThrottle{interval: interval, entries: make(map[string]*throttledLog)}
+}
+
+// allow reports whether a failure may be logged; failure is its error code, or the message without one
+func (t *logThrottle) allow(method, host, failure string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := method + " " + host + " " + failure
+	now := time.Now()
+	e := t.entries[key]
+	if e != nil && now.Sub(e.started) < t.interval {
+		e.suppressed++
+		return false
+	}
+	if e != nil {
+		e.summarize()
+	}
+	t.entries[key] = &throttledLog{method: method, host: host, failure: failure, started: now}
+	return true
+}
+
+func (e *throttledLog) summarize() {
+	if e.suppressed > 0 {
+		log.Printf("WARNING: check method=%s host=%s failed %d more times with %s since %s",
+			e.method, e.host, e.suppressed, e.failure, e.started.Format(time.TimeOnly))
+	}
+}
+
+// flushLoop reports and drops entries whose interval has passed, so a summary isn't
+// held back until the host fails again
+func (t *logThrottle) flushLoop() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.flush()
+	}
+}
+
+func (t *logThrottle) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-t.interval)
+	for key, e := range t.entries {
+		if e.started.Before(cutoff) {
+			e.summarize()
+			delete(t.entries, key)
+		}
+	}
+}
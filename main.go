@@ -3,12 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
-	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -16,188 +17,804 @@ import (
 
 // Response structure
 type Response struct {
-	Host   string `json:"host"`
-	Type   string `json:"type"`
-	Result any    `json:"result"` // Always include result, 0 on error
-	Error  string `json:"error,omitempty"`
+	Host      string `json:"host"`
+	Type      string `json:"type"`
+	Result    any    `json:"result"` // Always include result, 0 on error
+	Up        bool   `json:"up"`     // Single up/down verdict, decided by each check
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"` // Machine-readable failure class, e.g. CONNECT_TIMEOUT
+	Warning   string `json:"warning,omitempty"`    // Check succeeded but needs attention
+	Cached    bool   `json:"cached,omitempty"`     // Last result reused because of MIN_CHECK_INTERVAL
+	Proto     string `json:"proto,omitempty"`      // HTTP protocol the check used, e.g. HTTP/2.0
+	Partial   bool   `json:"partial,omitempty"`    // Check was cut short, result has what was collected
+	Attempts  int    `json:"attempts,omitempty"`   // Times the check ran, with retries
+	Retries   *int   `json:"retries,omitempty"`    // attempts-1, with retries; above 0 means the first try failed
+
+	Maintenance bool `json:"maintenance,omitempty"` // Not checked, the server is in maintenance mode
+
+	EffectiveParams map[string]any `json:"effective_params,omitempty"` // Params after defaults and validation, with verbose=true
+	ErrorDetails    *ErrorDetails  `json:"error_details,omitempty"`    // Structured cause of the error, with error_details=true
+
+	Changed *bool         `json:"changed,omitempty"` // Whether anything differs from the response in since
+	Changes []FieldChange `json:"changes,omitempty"` // What differs, with since
+
+	CorrelationID string `json:"correlation_id,omitempty"` // Echo of the caller's correlation_id (or tag)
+	Timestamp     string `json:"timestamp,omitempty"`      // When the check started, RFC 3339 in tz (UTC by default)
+
+	checkedAt time.Time // Timestamp before formatting, so cached results can be shown in another tz
+	precision int       // Decimals of latencies in Result, applied when marshaling
+}
+
+// MarshalJSON rounds the latencies in Result to the response's precision
+func (r Response) MarshalJSON() ([]byte, error) {
+	type plain Response // Without this method
+	p := plain(r)
+	p.Result = roundedResult{r.Result, r.precision}
+	return json.Marshal(p)
+}
+
+// Timestamps have millisecond precision, like the latencies
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// stampResponse sets Timestamp from checkedAt in the given location
+func stampResponse(resp *Response, loc *time.Location) {
+	if !resp.checkedAt.IsZero() {
+		resp.Timestamp = resp.checkedAt.In(loc).Format(timestampLayout)
+	}
+}
+
+// warningError is returned by checks that succeeded but found something worth flagging.
+// The result is kept and the message goes to Response.Warning.
+type warningError struct {
+	msg string
+}
+
+func (e warningError) Error() string { return e.msg }
+
+// upReporter is implemented by results whose success isn't implied by a nil error,
+// e.g. an HTTP check that got a 500 back.
+type upReporter interface {
+	Up() bool
 }
 
 var (
 	apiKey string
 	// Semaphore to limit concurrent checks (DoS/OOM protection)
-	concurrencyLimit chan struct{} // Declared here, initialized in main
+	concurrencyLimit *semaphore // Declared here, initialized in main, resizable via /admin/concurrency
+	// How long a request may wait for a free slot before getting a 503 (QUEUE_TIMEOUT)
+	queueTimeout time.Duration
+	// Per-target limiter so a single host can't be flooded by many clients
+	perHostLimit *hostLimiter // nil when PER_HOST_LIMIT is unset or 0
+	// Verbose logging (DEBUG=true)
+	debugMode bool
+	// Reject unknown methods instead of falling back to ping (STRICT_METHODS=true)
+	strictMethods bool
+	// Checks taking at least this long are logged as warnings (SLOW_THRESHOLD), 0 disables
+	slowThreshold time.Duration
 )
 
+// Server write timeout, also the margin added for long-running checks
+const writeTimeout = 10 * time.Second
+
 func main() {
 	// Get key at startup
 	apiKey = os.Getenv("API_KEY")
 	if apiKey == "" {
+		// Refuse to run an open prober when the deployment asked for auth
+		if os.Getenv("REQUIRE_API_KEY") == "true" {
+			log.Fatal("REQUIRE_API_KEY is set but API_KEY is empty, refusing to start")
+		}
 		log.Println("WARNING: API_KEY not set!")
 	}
 
 	// Get concurrency limit from env var, default to 20
-	limitStr := os.Getenv("CONCURRENCY_LIMIT")
-	limit := 20 // Default value
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		} else {
-			log.Printf("WARNING: Invalid CONCURRENCY_LIMIT '%s', using default %d", limitStr, limit)
+	limit := envInt("CONCURRENCY_LIMIT", 20, 0)
+	concurrencyLimit = newSemaphore(limit) // Initialize with the specified limit, 0 is unlimited
+	if limit == 0 {
+		log.Println("WARNING: Concurrency limit disabled (CONCURRENCY_LIMIT=0)")
+	} else {
+		log.Printf("Concurrency limit set to %d", limit)
+	}
+	queueTimeout = envDuration("QUEUE_TIMEOUT", 0)
+	adminKey = os.Getenv("ADMIN_KEY")
+	if d := envDuration("MAX_TIMEOUT", maxTimeout); d > 0 {
+		maxTimeout = d
+	} else {
+		log.Printf("WARNING: MAX_TIMEOUT must be positive, using default %s", maxTimeout)
+	}
+
+	rdapWarnDays = envInt("RDAP_EXPIRY_WARN_DAYS", rdapWarnDays, 0)
+	defaultSOCKS5Proxy = os.Getenv("SOCKS5_PROXY")
+	if _, err := socksDialer(defaultSOCKS5Proxy); err != nil {
+		log.Fatalf("Invalid SOCKS5_PROXY: %v", err)
+	}
+
+	if path := os.Getenv("CA_BUNDLE_FILE"); path != "" {
+		if err := useCABundle(path); err != nil {
+			log.Fatalf("Failed to load CA_BUNDLE_FILE: %v", err)
+		}
+		log.Printf("Trusting extra CAs from %s", path)
+	}
+
+	if v := os.Getenv("API_VERSION"); v != "" {
+		if !knownAPIVersion(v) {
+			log.Fatalf("Unknown API_VERSION %q, supported: %v", v, apiVersions)
+		}
+		defaultAPIVersion = v
+	}
+
+	if name := os.Getenv("DEFAULT_METHOD"); name != "" {
+		if _, ok := lookupMethod(name); !ok {
+			log.Fatalf("Unknown DEFAULT_METHOD %q, supported: %v", name, methodNames())
+		}
+		defaultMethod = name
+		log.Printf("Default method set to %s", name)
+	}
+
+	debugMode = os.Getenv("DEBUG") == "true"
+	slowThreshold = envDuration("SLOW_THRESHOLD", 0)
+	if interval := envDuration("LOG_THROTTLE_INTERVAL", 0); interval > 0 {
+		checkLogThrottle = newLogThrottle(interval)
+		go checkLogThrottle.flushLoop()
+	}
+	strictMethods = os.Getenv("STRICT_METHODS") == "true"
+	recoverPanics = os.Getenv("RECOVER_PANICS") != "false"
+	logRequests = os.Getenv("LOG_REQUESTS") == "true"
+	compressResponses = os.Getenv("COMPRESS_RESPONSES") != "false"
+	compressMinBytes = envInt("COMPRESS_MIN_BYTES", compressMinBytes, 0)
+	if list, ok := os.LookupEnv("REDACT_HEADERS"); ok {
+		redactedHeaders = parseHeaderList(list)
+	}
+	switch names := os.Getenv("JSON_FIELD_NAMES"); names {
+	case "", "snake":
+	case "camel":
+		camelCaseFields = true
+	default:
+		log.Fatalf("Unknown JSON_FIELD_NAMES %q, supported: snake, camel", names)
+	}
+	initPingPatterns(os.Getenv("PING_PARSE_REGEX"))
+
+	anchors := os.Getenv("INTERNET_ANCHORS")
+	if anchors == "" {
+		anchors = defaultInternetAnchors
+	}
+	parsed, err := parseInternetAnchors(anchors)
+	if err != nil {
+		log.Fatalf("Invalid INTERNET_ANCHORS: %v", err)
+	}
+	internetAnchors = parsed
+
+	if s := os.Getenv("NAT64_PREFIX"); s != "" {
+		prefix, err := parseNAT64Prefix(s)
+		if err != nil {
+			log.Fatalf("Invalid NAT64_PREFIX: %v", err)
+		}
+		nat64Prefix = prefix
+		log.Printf("nat64=true checks use NAT64 prefix %s", prefix)
+	}
+
+	if list := os.Getenv("NETNS_ALLOW"); list != "" {
+		if err := netnsUsable(); err != nil {
+			log.Fatalf("NETNS_ALLOW is set, but switching network namespaces failed (needs CAP_SYS_ADMIN): %v", err)
+		}
+		allowedNetns = parseNetnsAllow(list)
+		log.Printf("Checks may run in network namespaces: %v", netnsNames())
+	}
+
+	if pingDisabled = os.Getenv("DISABLE_PING") == "true"; pingDisabled {
+		log.Println("Ping disabled, method=ping requests get 405")
+	} else if err := pingUsable(); pingExecError(err) != nil {
+		log.Printf("ERROR: %v. Every ping and pmtu check will fail with %s until then.", errPingMissing, codePingBinaryMissing)
+	} else if err != nil {
+		log.Printf("WARNING: ping doesn't work here, ping checks will fail (set DISABLE_PING=true to reject them): %v", err)
+	}
+
+	maxBatchSize = envInt("MAX_BATCH_SIZE", maxBatchSize, 1)
+	maxCIDRHosts = envInt("MAX_CIDR_HOSTS", maxCIDRHosts, 1)
+	maxThroughputBytes = int64(envInt("MAX_THROUGHPUT_BYTES", int(maxThroughputBytes), 1))
+	maxRedirects = envInt("MAX_REDIRECTS", maxRedirects, 0)
+	maxQueryBytes = envInt("MAX_QUERY_BYTES", maxQueryBytes, 1)
+	maxQueryParams = envInt("MAX_QUERY_PARAMS", maxQueryParams, 1)
+
+	// Per-host limit is disabled by default
+	if hostLimit := envInt("PER_HOST_LIMIT", 0, 0); hostLimit > 0 {
+		perHostLimit = newHostLimiter(hostLimit)
+		go perHostLimit.cleanupLoop(time.Minute)
+		log.Printf("Per-host concurrency limit set to %d", hostLimit)
+	}
+
+	// Maintenance mode, switched at runtime with /admin/maintenance
+	maintenance.enabled = os.Getenv("MAINTENANCE") == "true"
+	windows, err := parseMaintenanceWindows(os.Getenv("MAINTENANCE_WINDOWS"))
+	if err != nil {
+		log.Fatalf("Invalid MAINTENANCE_WINDOWS: %v", err)
+	}
+	maintenance.windows = windows
+	if maintenance.enabled {
+		log.Println("Maintenance mode enabled, checks are answered without probing")
+	}
+	if len(windows) > 0 {
+		log.Printf("%d maintenance windows scheduled", len(windows))
+	}
+
+	// Per-client concurrency limit is disabled by default
+	if limit := envInt("MAX_INFLIGHT_PER_IP", 0, 0); limit > 0 {
+		clientInflightLimit = newInflightLimiter(limit)
+		log.Printf("Concurrent requests limited to %d per client", limit)
+	}
+
+	// Per-client rate limit is disabled by default
+	if limit := envInt("RATE_LIMIT", 0, 0); limit > 0 {
+		window := envDuration("RATE_LIMIT_WINDOW", time.Minute)
+		if window <= 0 {
+			log.Fatal("RATE_LIMIT_WINDOW must be positive")
+		}
+		clientRateLimit = newRateLimiter(limit, window)
+		go clientRateLimit.cleanupLoop(max(window, time.Minute))
+		log.Printf("Rate limit set to %d requests per %s per client", limit, window)
+	}
+
+	var publishers multiPublisher
+	if rawURL := os.Getenv("PUBLISH_URL"); rawURL != "" {
+		subject := os.Getenv("PUBLISH_SUBJECT")
+		if subject == "" {
+			subject = "pinger.results"
+		}
+		p, err := newPublisher(rawURL, subject)
+		if err != nil {
+			log.Fatalf("Invalid PUBLISH_URL: %v", err)
+		}
+		publishers = append(publishers, p)
+		log.Printf("Publishing check results to %s", subject)
+	}
+	if rawURL := os.Getenv("PUSHGATEWAY_URL"); rawURL != "" {
+		job := os.Getenv("PUSHGATEWAY_JOB")
+		if job == "" {
+			job = "pinger"
+		}
+		p, err := newPushgatewayPublisher(rawURL, job)
+		if err != nil {
+			log.Fatalf("Invalid PUSHGATEWAY_URL: %v", err)
+		}
+		publishers = append(publishers, p)
+		log.Printf("Pushing check results to the Pushgateway as job %s", job)
+	}
+	switch len(publishers) {
+	case 0:
+	case 1:
+		resultPublisher = publishers[0]
+	default:
+		resultPublisher = publishers
+	}
+
+	// Banning clients after failed key checks is disabled by default
+	if threshold := envInt("AUTH_BAN_THRESHOLD", 0, 0); threshold > 0 {
+		window := envDuration("AUTH_BAN_WINDOW", 10*time.Minute)
+		duration := envDuration("AUTH_BAN_DURATION", 15*time.Minute)
+		if window <= 0 || duration <= 0 {
+			log.Fatal("AUTH_BAN_WINDOW and AUTH_BAN_DURATION must be positive")
+		}
+		authBans = newAuthBanList(threshold, window, duration)
+		go authBans.cleanupLoop(time.Minute)
+		log.Printf("Clients with %d failed auth attempts within %s are banned for %s", threshold, window, duration)
+	}
+
+	if interval := envDuration("MIN_CHECK_INTERVAL", 0); interval > 0 {
+		minCheckInterval = newCheckThrottle(interval)
+		go minCheckInterval.cleanupLoop(max(interval, time.Minute))
+		log.Printf("Minimum interval between checks of the same host set to %s", interval)
+	}
+
+	if d := envDuration("SHUTDOWN_TIMEOUT", shutdownTimeout); d > 0 {
+		shutdownTimeout = d
+	}
+
+	if path := os.Getenv("TARGETS_FILE"); path != "" {
+		m, err := newMonitor(path, envDuration("SELF_CHECK_INTERVAL", time.Minute))
+		if err != nil {
+			log.Fatalf("Failed to load TARGETS_FILE: %v", err)
 		}
+		if m.interval <= 0 {
+			log.Fatal("SELF_CHECK_INTERVAL must be positive")
+		}
+		selfMonitor = m
+		go m.run(context.Background())
+		log.Printf("Self-checks every %s", m.interval)
 	}
-	concurrencyLimit = make(chan struct{}, limit) // Initialize with the specified limit
-	log.Printf("Concurrency limit set to %d", limit)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", handleRequest)
+	mux.HandleFunc("/methods", handleMethods)
+	mux.HandleFunc("/batch", handleBatch)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/ready", handleReady)
+	mux.HandleFunc("/admin/concurrency", handleAdminConcurrency)
+	mux.HandleFunc("/admin/maintenance", handleAdminMaintenance)
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/metrics", handleMetrics)
 
 	// Configure server
 	server := &http.Server{
 		Addr:         ":80",
-		Handler:      mux,
+		Handler:      logRequest(gzipResponses(recoverHandler(rejectBanned(limitRate(limitInflight(limitQuery(mux))))))),
 		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: writeTimeout,
 		IdleTimeout:  120 * time.Second,
 	}
 
 	log.Println("Server started on :80")
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	serve(server)
+}
+
+func debugf(format string, args ...any) {
+	if debugMode {
+		log.Printf("DEBUG: "+format, args...)
+	}
+}
+
+// envInt reads an integer env var, falling back to def when unset or below min
+func envInt(name string, def, min int) int {
+	str := os.Getenv(name)
+	if str == "" {
+		return def
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil || val < min {
+		log.Printf("WARNING: Invalid %s '%s', using default %d", name, str, def)
+		return def
+	}
+	return val
+}
+
+// envDuration reads a Go duration env var such as "2s" or "500ms"
+func envDuration(name string, def time.Duration) time.Duration {
+	str := os.Getenv(name)
+	if str == "" {
+		return def
+	}
+	val, err := time.ParseDuration(str)
+	if err != nil || val < 0 {
+		log.Printf("WARNING: Invalid %s '%s', using default %s", name, str, def)
+		return def
+	}
+	return val
+}
+
+// writeError sends a JSON error body with the given status
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": msg}); err != nil {
+		log.Printf("Failed to write error response: %v", err)
 	}
 }
 
+// authorized checks the key query param against API_KEY (if set)
+func authorized(r *http.Request) bool {
+	return apiKey == "" || checkKey(r, apiKey)
+}
+
 func handleRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	query := r.URL.Query()
+	nagios := query.Get("format") == "nagios"
+
 	// Helper function to send JSON error
 	sendError := func(status int, msg string) {
-		w.WriteHeader(status)
-		if err := json.NewEncoder(w).Encode(map[string]string{"error": msg}); err != nil {
-			log.Printf("Failed to write error response: %v", err)
+		if nagios {
+			writeNagiosStatus(w, status, nagiosUnknown, "UNKNOWN - "+msg)
+			return
 		}
+		writeError(w, status, msg)
 	}
 
 	// 1. API Key Check
-	query := r.URL.Query()
-	userKey := query.Get("key")
 
-	if apiKey != "" && userKey != apiKey {
+	if !authorized(r) {
 		sendError(http.StatusForbidden, "Auth failed")
 		return
 	}
 
+	version, ok := requestAPIVersion(w, r)
+	if !ok {
+		return
+	}
+
+	// Disabled methods are refused before any slot is taken, sweeps and backends included
+	method, _ := resolveMethod(query.Get("method"))
+	if err := methodEnabled(method); err != nil {
+		sendError(http.StatusMethodNotAllowed, err.Error())
+		return
+	}
+
+	// Subnet sweep instead of a single host
+	if query.Has("cidr") {
+		handleSweep(w, r, query, version)
+		return
+	}
+	// Every backend behind host (or the service_dns SRV name), aggregated into one verdict
+	if query.Has("backends") || query.Has("service_dns") {
+		handleBackends(w, r, query, version)
+		return
+	}
+
 	// 2. Parameter Validation
 	host := query.Get("host")
-	if host == "" {
+	if _, info := resolveMethod(query.Get("method")); host == "" && info.hasParam("host") {
 		sendError(http.StatusBadRequest, "host required")
 		return
 	}
 
 	// 3. Concurrency Limiting
-	// Try to acquire a slot in the semaphore
-	select {
-	case concurrencyLimit <- struct{}{}:
-		// Slot acquired, release on function exit
-		defer func() { <-concurrencyLimit }()
-	case <-r.Context().Done():
-		// Client disconnected while waiting
-		return
-	default:
+	// Try to acquire a slot in the semaphore, the wait time tells overload apart from short bursts
+	wait, ok := acquireSlot(r.Context())
+	w.Header().Set("X-Pinger-Queue-Wait-Ms", strconv.FormatFloat(durationMs(wait), 'f', -1, 64))
+	if !ok {
+		if r.Context().Err() != nil {
+			// Client disconnected while waiting
+			return
+		}
 		// All slots busy, server overloaded
 		sendError(http.StatusServiceUnavailable, "Server is too busy, try again later")
 		return
 	}
+	// Slot acquired, release on function exit
+	defer concurrencyLimit.release()
+
+	// Per-host limit on top of the global one
+	if perHostLimit != nil && host != "" {
+		release, ok := perHostLimit.acquire(host)
+		if !ok {
+			sendError(http.StatusServiceUnavailable, "Too many concurrent checks for this host, try again later")
+			return
+		}
+		defer release()
+	}
 
 	// 4. Method Selection
-	method := query.Get("method")
-	if method != "http" && method != "https" {
-		method = "ping"
+	if name := query.Get("method"); strictMethods && name != "" {
+		if _, ok := lookupMethod(name); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			body := map[string]any{"error": fmt.Sprintf("unknown method %q", name), "supported": methodNames()}
+			if err := json.NewEncoder(w).Encode(body); err != nil {
+				log.Printf("Failed to write error response: %v", err)
+			}
+			return
+		}
+	}
+	method, m := resolveMethod(query.Get("method"))
+
+	if f := query.Get("format"); f != "" && f != "json" && f != "nagios" {
+		sendError(http.StatusBadRequest, fmt.Sprintf("unsupported format %q", f))
+		return
+	}
+	thresholds, err := parseNagiosThresholds(query)
+	if err != nil {
+		sendError(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := checkParams{Host: host, Query: query, Client: clientIP(r)}
+	if r.Method == http.MethodPost && r.Body != nil {
+		// Kept for checks that pass the body through (http/https)
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPCheckBody+1))
+		if err != nil {
+			sendError(http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		params.Body = body
+		params.BodyType = r.Header.Get("Content-Type")
 	}
 
-	var result any
-	var err error
 	ctx := r.Context() // Pass request context to cancel operations
+	extendWriteDeadline(w, checkDuration(m, params))
 
 	// 5. Execution
-	switch method {
-	case "http":
-		result, err = checkHTTP(ctx, host, "http")
-	case "https":
-		result, err = checkHTTP(ctx, host, "https")
-	default: // ping
-		result, err = checkPing(ctx, host)
+	resp, wait, err := runThrottled(ctx, method, m, params)
+	if err != nil {
+		sendError(http.StatusBadRequest, err.Error())
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		sendError(http.StatusTooManyRequests, "This host was checked too recently, try again later")
+		return
 	}
 
 	// 6. Response
-	resp := Response{
-		Host: host,
-		Type: method,
+	if nagios {
+		state, line := formatNagios(resp, thresholds)
+		writeNagios(w, state, line)
+		return
+	}
+	writeJSON(w, r, shapeResponse(resp, version, query.Get("fields")))
+}
+
+// acquireSlot takes a slot in the global semaphore, waiting up to QUEUE_TIMEOUT for one
+// (0 fails right away). ok is false if the server stayed busy or ctx ended first.
+func acquireSlot(ctx context.Context) (wait time.Duration, ok bool) {
+	if concurrencyLimit.tryAcquire() {
+		return 0, true
+	}
+	if queueTimeout <= 0 {
+		return 0, false
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, queueTimeout)
+	defer cancel()
+	err := concurrencyLimit.acquire(ctx)
+	return time.Since(start), err == nil
+}
+
+// checkDuration is how long a check may legitimately run, 0 if it's a normal short check
+func checkDuration(m methodInfo, p checkParams) time.Duration {
+	d := singleCheckDuration(m, p)
+	// Every retry may take as long as the first attempt
+	if n, _ := p.retries(m); n > 0 {
+		if d == 0 {
+			d = defaultCheckTimeout
+		}
+		d = d*time.Duration(n+1) + retryDelay*time.Duration(n)
+	}
+	return d
+}
+
+func singleCheckDuration(m methodInfo, p checkParams) time.Duration {
+	if lr, ok := m.checker.(longRunningChecker); ok {
+		return lr.MaxDuration(p)
+	}
+	// A timeout above the default may outlast WriteTimeout
+	if m.hasParam("timeout") {
+		if total, _, err := p.timeouts(); err == nil && total > defaultCheckTimeout {
+			return total
+		}
+	}
+	return 0
+}
+
+// extendWriteDeadline pushes the write deadline past d so a long check's response isn't cut off by WriteTimeout
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d + writeTimeout)); err != nil {
+		debugf("could not extend write deadline: %v", err)
+	}
+}
+
+// resolveMethod falls back to the default method when name is missing or unknown
+func resolveMethod(name string) (string, methodInfo) {
+	if m, ok := lookupMethod(name); ok {
+		return name, m
+	}
+	m, _ := lookupMethod(defaultMethod)
+	return defaultMethod, m
+}
+
+// errPingDisabled answers method=ping and pmtu when DISABLE_PING=true
+var errPingDisabled = errors.New("ping disabled")
+
+// methodEnabled rejects methods switched off in this deployment
+func methodEnabled(method string) error {
+	if (method == "ping" || method == "pmtu") && pingDisabled {
+		return errPingDisabled
+	}
+	return nil
+}
+
+// validateCheck runs the checker's own param validation, if it has any
+func validateCheck(m methodInfo, p checkParams) error {
+	if _, err := p.expectExpr(m); err != nil {
+		return err
+	}
+	if _, err := p.location(); err != nil {
+		return err
+	}
+	if _, err := p.retries(m); err != nil {
+		return err
 	}
+	if _, err := p.precision(); err != nil {
+		return err
+	}
+	if v, ok := m.checker.(paramValidator); ok {
+		return v.Validate(p)
+	}
+	return nil
+}
 
+// runCheck executes a check and builds its Response.
+// The error is only set for invalid params (paramError), check failures go into the Response.
+func runCheck(ctx context.Context, method string, m methodInfo, params checkParams) (Response, error) {
+	expect, err := params.expectExpr(m)
+	if err != nil {
+		return Response{}, err
+	}
+	loc, err := params.location()
+	if err != nil {
+		return Response{}, err
+	}
+	retries, err := params.retries(m)
 	if err != nil {
+		return Response{}, err
+	}
+	precision, err := params.precision()
+	if err != nil {
+		return Response{}, err
+	}
+
+	start := time.Now()
+	result, attempts, err := retryCheck(ctx, m, params, retries)
+
+	var pe paramError
+	if errors.As(err, &pe) {
+		return Response{}, pe
+	}
+
+	id := params.correlationID()
+	logCheck(method, params.Host, id, time.Since(start), result, err)
+
+	resp := Response{
+		Host:          params.Host,
+		Type:          method,
+		CorrelationID: id,
+		checkedAt:     start,
+		precision:     precision,
+	}
+	stampResponse(&resp, loc)
+
+	if retries > 0 {
+		resp.Attempts = attempts
+		retried := attempts - 1
+		resp.Retries = &retried
+	}
+	if params.Get("verbose") == "true" {
+		resp.EffectiveParams = effectiveParams(method, m, params)
+	}
+	if m.hasParam("timeout") && params.timeoutClamped() {
+		resp.Warning = fmt.Sprintf("timeout clamped to %s", maxTimeout)
+	}
+
+	var warn warningError
+	var partial partialError
+	if errors.As(err, &warn) {
+		resp.Warning = joinWarnings(resp.Warning, warn.msg)
+		resp.Result = result
+		resp.Up = true
+	} else if errors.As(err, &partial) {
+		resp.Error = err.Error()
+		resp.ErrorCode = errorCode(err)
+		resp.Result = result
+		resp.Partial = true
+	} else if err != nil {
 		resp.Error = err.Error()
+		resp.ErrorCode = errorCode(err)
 		resp.Result = 0 // Set result to 0 on error as requested
 	} else {
 		resp.Result = result
+		resp.Up = true
+	}
+	if resp.Error != "" && params.Get("error_details") == "true" {
+		resp.ErrorDetails = errorDetails(err)
+	}
+	if u, ok := result.(upReporter); ok && resp.Up {
+		resp.Up = u.Up()
+	}
+	if pr, ok := result.(protoReporter); ok {
+		resp.Proto = pr.Proto()
 	}
 
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		log.Printf("JSON encode error: %v", err)
+	if expect != nil && resp.Error == "" && !truthy(expect.eval(exprVars(resp))) {
+		resp.Up = false
+		resp.Error = fmt.Sprintf("expect failed: %s", params.Get("expect"))
+		resp.ErrorCode = codeExpectFailed
 	}
+	return resp, nil
 }
 
-func checkPing(ctx context.Context, host string) (float64, error) {
-	// Use CommandContext to cancel ping if user request is cancelled
-	cmd := exec.CommandContext(ctx, "ping", "-c", "3", "-W", "2", "-q", host)
-	output, err := cmd.CombinedOutput()
+// retryCheck runs the check, and again up to retries times while it fails or reports down.
+// Invalid params, warnings and partial results aren't retried.
+func retryCheck(ctx context.Context, m methodInfo, params checkParams, retries int) (result any, attempts int, err error) {
+	for {
+		attempts++
+		result, err = safeCheck(ctx, m, params)
+		if attempts > retries || !retryable(result, err) {
+			return result, attempts, err
+		}
+		select {
+		case <-ctx.Done():
+			return result, attempts, err
+		case <-time.After(retryDelay):
+		}
+	}
+}
 
+func retryable(result any, err error) bool {
+	var pe paramError
+	var warn warningError
+	var partial partialError
+	if errors.As(err, &pe) || errors.As(err, &warn) || errors.As(err, &partial) {
+		return false
+	}
 	if err != nil {
-		return 0, fmt.Errorf("ping failed: host unreachable or timeout")
+		return true
 	}
+	u, ok := result.(upReporter)
+	return ok && !u.Up()
+}
 
-	// Parse Linux ping output
-	re := regexp.MustCompile(`(?m)/(\d+\.\d+)/(\d+\.\d+)/`)
-	matches := re.FindStringSubmatch(string(output))
-
-	if len(matches) >= 3 {
-		val, err := strconv.ParseFloat(matches[2], 64)
-		if err != nil {
-			return 0, fmt.Errorf("parse error: %w", err)
-		}
-		// Check for "0" in case of bad parse
-		if val <= 0 {
-			return 0, fmt.Errorf("invalid ping result: %v", val)
-		}
-		return val, nil
+// joinWarnings combines two warnings, either of which may be empty
+func joinWarnings(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
 	}
-
-	return 0, fmt.Errorf("could not parse ping output")
+	return a + "; " + b
 }
 
-func checkHTTP(ctx context.Context, host, scheme string) (int, error) {
-	host = strings.TrimPrefix(host, "http://")
-	host = strings.TrimPrefix(host, "https://")
+// shapeResponse applies the API version and then the fields filter
+func shapeResponse(resp Response, version, fields string) any {
+	return selectFields(versioned(resp, version), fields)
+}
 
-	url := fmt.Sprintf("%s://%s", scheme, host)
+// selectFields keeps only the comma-separated top-level fields of resp (fields=up,result).
+// An empty spec returns resp unchanged; unknown names are ignored.
+func selectFields(resp any, spec string) any {
+	if spec == "" {
+		return resp
+	}
 
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	data, err := json.Marshal(resp)
 	if err != nil {
-		return 0, err
+		return resp
+	}
+	if camelCaseFields {
+		// Named here, encodeJSON sees a map and leaves its keys alone
+		if data, err = renameFields(data, resp, camelCase); err != nil {
+			return resp
+		}
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return resp
 	}
 
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: nil,
-		},
+	selected := make(map[string]json.RawMessage)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if camelCaseFields {
+			name = camelCase(name) // Either naming works in fields
+		}
+		if val, ok := all[name]; ok {
+			selected[name] = val
+		}
 	}
+	return selected
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
+// logCheck only logs checks slower than SLOW_THRESHOLD, everything else goes to debug.
+// Repeated failures of a host are collapsed by LOG_THROTTLE_INTERVAL.
+func logCheck(method, host, correlationID string, elapsed time.Duration, result any, err error) {
+	slow := slowThreshold > 0 && elapsed >= slowThreshold
+	if !slow && !debugMode {
+		return
+	}
+	if err != nil && checkLogThrottle != nil {
+		failure := errorCode(err)
+		if failure == "" {
+			failure = fmt.Sprintf("%q", err.Error())
+		}
+		if !checkLogThrottle.allow(method, host, failure) {
+			return
+		}
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode, nil
-}
\ No newline at end of file
+	id := ""
+	if correlationID != "" {
+		id = fmt.Sprintf(" correlation_id=%q", correlationID)
+	}
+	if slow {
+		log.Printf("WARNING: slow check method=%s host=%s%s duration=%s result=%v error=%v", method, host, id, elapsed, result, err)
+		return
+	}
+	debugf("check method=%s host=%s%s duration=%s result=%v error=%v", method, host, id, elapsed, result, err)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceMode answers checks without probing during planned downtime: switched on
+// by MAINTENANCE=true or /admin/maintenance, or scheduled with MAINTENANCE_WINDOWS
+type maintenanceMode struct {
+	mu      sync.Mutex
+	enabled bool
+	until   time.Time // Zero while enabled without an end
+	windows []maintenanceWindow
+}
+
+var maintenance = &maintenanceMode{}
+
+// maintenanceWindow is either a fixed interval or a daily/weekly time range in UTC
+type maintenanceWindow struct {
+	spec       string
+	start, end time.Time     // Fixed interval
+	weekday    time.Weekday  // Weekly range, with weekly set
+	weekly     bool          // Otherwise daily
+	from, to   time.Duration // Recurring range as time of day, to < from wraps past midnight
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseMaintenanceWindows reads a comma-separated MAINTENANCE_WINDOWS list. Each window is
+// an RFC 3339 interval (2024-05-01T22:00:00Z/2024-05-02T02:00:00Z), a daily range
+// (02:00-04:00) or a weekly one (Sun 02:00-04:00); ranges are UTC.
+func parseMaintenanceWindows(s string) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		w, err := parseMaintenanceWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %w", spec, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseMaintenanceWindow(spec string) (maintenanceWindow, error) {
+	w := maintenanceWindow{spec: spec}
+	if start, end, ok := strings.Cut(spec, "/"); ok {
+		var err error
+		if w.start, err = time.Parse(time.RFC3339, start); err != nil {
+			return w, err
+		}
+		if w.end, err = time.Parse(time.RFC3339, end); err != nil {
+			return w, err
+		}
+		if !w.end.After(w.start) {
+			return w, fmt.Errorf("end must be after start")
+		}
+		return w, nil
+	}
+
+	rng := spec
+	if day, rest, ok := strings.Cut(spec, " "); ok {
+		wd, known := weekdayNames[strings.ToLower(day)]
+		if !known {
+			return w, fmt.Errorf("unknown weekday %q, use Mon, Tue, ...", day)
+		}
+		w.weekday, w.weekly, rng = wd, true, strings.TrimSpace(rest)
+	}
+	from, to, ok := strings.Cut(rng, "-")
+	if !ok {
+		return w, fmt.Errorf("want start/end, HH:MM-HH:MM or Day HH:MM-HH:MM")
+	}
+	var err error
+	if w.from, err = timeOfDay(from); err != nil {
+		return w, err
+	}
+	if w.to, err = timeOfDay(to); err != nil {
+		return w, err
+	}
+	if w.from == w.to {
+		return w, fmt.Errorf("range is empty")
+	}
+	return w, nil
+}
+
+func timeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a time like 02:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w maintenanceWindow) contains(t time.Time) bool {
+	if !w.start.IsZero() {
+		return !t.Before(w.start) && t.Before(w.end)
+	}
+	t = t.UTC()
+	day := t.Weekday()
+	offset := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	if w.from < w.to {
+		return (!w.weekly || day == w.weekday) && offset >= w.from && offset < w.to
+	}
+	// Past midnight: the evening of the start day, or the early hours of the next one
+	if offset >= w.from {
+		return !w.weekly || day == w.weekday
+	}
+	return offset < w.to && (!w.weekly || day == (w.weekday+1)%7)
+}
+
+// active reports whether checks are in maintenance at t, and why
+func (m *maintenanceMode) active(t time.Time) (bool, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.enabled && !m.until.IsZero() && !t.Before(m.until) {
+		m.enabled, m.until = false, time.Time{}
+		log.Printf("Maintenance mode ended")
+	}
+	if m.enabled {
+		return true, "maintenance mode"
+	}
+	for _, w := range m.windows {
+		if w.contains(t) {
+			return true, "maintenance window " + w.spec
+		}
+	}
+	return false, ""
+}
+
+func (m *maintenanceMode) set(enabled bool, until time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled, m.until = enabled, until
+}
+
+// maintenanceResponse stands in for a check that wasn't run because of maintenance.
+// It's up, so monitors polling during the downtime don't alert.
+func maintenanceResponse(method string, params checkParams, at time.Time) Response {
+	resp := Response{
+		Host:          params.Host,
+		Type:          method,
+		Result:        0,
+		Up:            true,
+		Maintenance:   true,
+		CorrelationID: params.correlationID(),
+		checkedAt:     at,
+	}
+	loc, _ := params.location() // Validated before
+	stampResponse(&resp, loc)
+	return resp
+}
+
+// handleAdminMaintenance reports maintenance mode (GET) or switches it (PUT ?enabled=true&until=2h)
+func handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !adminAuthorized(r) {
+		writeError(w, http.StatusForbidden, "Auth failed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		q := r.URL.Query()
+		enabled := q.Get("enabled")
+		if enabled != "true" && enabled != "false" {
+			writeError(w, http.StatusBadRequest, "enabled must be true or false")
+			return
+		}
+		var until time.Time
+		if s := q.Get("until"); s != "" {
+			if enabled == "false" {
+				writeError(w, http.StatusBadRequest, "until only goes with enabled=true")
+				return
+			}
+			var err error
+			if until, err = parseUntil(s, time.Now()); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		maintenance.set(enabled == "true", until)
+		switch {
+		case enabled == "false":
+			log.Printf("Maintenance mode disabled")
+		case until.IsZero():
+			log.Printf("Maintenance mode enabled")
+		default:
+			log.Printf("Maintenance mode enabled until %s", until.UTC().Format(time.RFC3339))
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, http.StatusMethodNotAllowed, "GET or PUT required")
+		return
+	}
+
+	active, reason := maintenance.active(time.Now())
+	maintenance.mu.Lock()
+	body := map[string]any{"active": active, "enabled": maintenance.enabled}
+	if active {
+		body["reason"] = reason
+	}
+	if !maintenance.until.IsZero() {
+		body["until"] = maintenance.until.UTC().Format(time.RFC3339)
+	}
+	windows := make([]string, len(maintenance.windows))
+	for i, mw := range maintenance.windows {
+		windows[i] = mw.spec
+	}
+	maintenance.mu.Unlock()
+	body["windows"] = windows
+	writeJSON(w, r, body)
+}
+
+// parseUntil accepts a duration from now (2h) or an RFC 3339 time
+func parseUntil(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil || !t.After(now) {
+		return time.Time{}, fmt.Errorf("until must be a positive duration like 2h or a future RFC 3339 time")
+	}
+	return t, nil
+}
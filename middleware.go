@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Limits for limitQuery (MAX_QUERY_BYTES, MAX_QUERY_PARAMS)
+var (
+	maxQueryBytes  = 16 << 10
+	maxQueryParams = 200
+)
+
+// Turn panics into 500s and failed checks instead of taking other requests down (RECOVER_PANICS)
+var recoverPanics = true
+
+// Log every request with its query, redacted (LOG_REQUESTS)
+var logRequests bool
+
+// Query params whose values never go into logs
+var redactedParams = map[string]bool{"key": true, "password": true}
+
+// Query params holding proxy URLs, logged with their user info redacted
+var proxyURLParams = map[string]bool{"socks5": true, "connect_proxy": true}
+
+// Headers that carry credentials (REDACT_HEADERS): their values are redacted in logged
+// header= params and they're left out of return_headers
+const defaultRedactedHeaders = "Authorization,Proxy-Authorization,Cookie,Set-Cookie,X-Api-Key"
+
+var redactedHeaders = parseHeaderList(defaultRedactedHeaders)
+
+// parseHeaderList reads comma-separated header names into a set of canonical names
+func parseHeaderList(list string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	return names
+}
+
+// redactURL is the path and query of u with the values of redactedParams, the user info
+// of proxyURLParams and header= params naming a redactedHeaders header replaced, keeping
+// the order and encoding of everything else
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	pairs := strings.Split(u.RawQuery, "&")
+	for i, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		n, err := url.QueryUnescape(name)
+		if err != nil {
+			continue
+		}
+		switch {
+		case redactedParams[n]:
+			pairs[i] = name + "=REDACTED"
+		case proxyURLParams[n]:
+			v, err := url.QueryUnescape(value)
+			if err != nil {
+				v = value
+			}
+			if redacted, ok := redactProxyUser(v); ok {
+				pairs[i] = name + "=" + url.QueryEscape(redacted)
+			}
+		case n == "header":
+			v, _ := url.QueryUnescape(value)
+			if h, _, ok := strings.Cut(v, ":"); ok && redactedHeaders[http.CanonicalHeaderKey(strings.TrimSpace(h))] {
+				pairs[i] = name + "=" + url.QueryEscape(strings.TrimSpace(h)+": REDACTED")
+			}
+		}
+	}
+	return u.Path + "?" + strings.Join(pairs, "&")
+}
+
+// redactProxyUser replaces the user and password in a proxy URL, with or without a scheme
+// (user:pass@proxy:1080); ok is false when there's nothing to redact
+func redactProxyUser(v string) (string, bool) {
+	scheme := ""
+	if !strings.Contains(v, "://") {
+		scheme = "x://" // So url.Parse finds the user info
+	}
+	u, err := url.Parse(scheme + v)
+	if err != nil || u.User == nil {
+		if at := strings.LastIndex(v, "@"); at >= 0 {
+			return "REDACTED@" + v[at+1:], true // Unparsable, but still has credentials
+		}
+		return "", false
+	}
+	u.User = url.UserPassword("REDACTED", "")
+	return strings.TrimPrefix(u.String(), scheme), true
+}
+
+// statusRecorder remembers the status code written through it for logRequest
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streamed batches streaming
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend write deadlines
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// logRequest logs each request with its redacted URL, status and duration when LOG_REQUESTS=true
+func logRequest(next http.Handler) http.Handler {
+	if !logRequests {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		log.Printf("REQUEST client=%s %s %q status=%d duration=%s", clientIP(r), r.Method, redactURL(r.URL), rec.status, time.Since(start))
+	})
+}
+
+// limitQuery rejects oversized query strings before they're parsed
+func limitQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.RawQuery
+		if len(raw) > maxQueryBytes {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("query string too large (max %d bytes)", maxQueryBytes))
+			return
+		}
+		if raw != "" && strings.Count(raw, "&")+1 > maxQueryParams {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("too many query parameters (max %d)", maxQueryParams))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverHandler logs a panic in next with its stack trace and answers with a 500
+func recoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if recoverPanics {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				q := r.URL.Query()
+				log.Printf("PANIC serving %s %q correlation_id=%q: %v\n%s",
+					r.Method, redactURL(r.URL), q.Get("correlation_id"), v, debug.Stack())
+				w.Header().Set("Content-Type", "application/json")
+				writeError(w, http.StatusInternalServerError, "Internal server error")
+			}()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// safeCheck runs the checker, turning a panic into a failed check. Batch entries and
+// self-checks run in their own goroutines, where a panic would crash the whole server.
+func safeCheck(ctx context.Context, m methodInfo, params checkParams) (result any, err error) {
+	if recoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				log.Printf("PANIC in %s check of %q correlation_id=%q: %v\n%s", m.Name, params.Host, params.correlationID(), v, debug.Stack())
+				result, err = 0, fmt.Errorf("internal error in %s check", m.Name)
+			}
+		}()
+	}
+	return m.checker.Check(ctx, params)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// monitorResult is the latest outcome of a scheduled target
+type monitorResult struct {
+	Name      string    `json:"name"`
+	Response  Response  `json:"response"`
+	CheckedAt time.Time `json:"checked_at"`
+	Duration  float64   `json:"duration_ms"`
+}
+
+// monitor runs the checks from TARGETS_FILE every SELF_CHECK_INTERVAL and keeps the latest results
+type monitor struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	targets []monitorTarget
+	results map[string]monitorResult
+}
+
+type monitorTarget struct {
+	name string
+	job  batchJob
+}
+
+// nil unless TARGETS_FILE is set
+var selfMonitor *monitor
+
+func newMonitor(path string, interval time.Duration) (*monitor, error) {
+	m := &monitor{path: path, interval: interval, results: make(map[string]monitorResult)}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// load reads the targets file, a JSON array in the /batch format. An optional "name"
+// labels the target, it defaults to method:host.
+func (m *monitor) load() error {
+	f, err := os.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []map[string]any
+	if err := json.NewDecoder(io.LimitReader(f, maxBatchBody)).Decode(&entries); err != nil {
+		return fmt.Errorf("%s: expected a JSON array of objects: %v", m.path, err)
+	}
+
+	targets := make([]monitorTarget, 0, len(entries))
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		name, _ := entry["name"].(string)
+		delete(entry, "name")
+		job, err := newBatchJob(entry)
+		if err != nil {
+			return fmt.Errorf("%s: entry %d: %v", m.path, i, err)
+		}
+		if name == "" {
+			name = job.method + ":" + job.params.Host
+		}
+		if seen[name] {
+			return fmt.Errorf("%s: duplicate target name %q", m.path, name)
+		}
+		seen[name] = true
+		targets = append(targets, monitorTarget{name: name, job: job})
+	}
+
+	m.mu.Lock()
+	m.targets = targets
+	// Drop results of targets that were removed
+	for name := range m.results {
+		if !seen[name] {
+			delete(m.results, name)
+		}
+	}
+	m.mu.Unlock()
+	log.Printf("Loaded %d targets from %s", len(targets), m.path)
+	return nil
+}
+
+// run checks all targets right away and then every interval, reloading the file on SIGHUP
+func (m *monitor) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.checkAll(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			m.checkAll(ctx)
+		case <-hup:
+			if err := m.load(); err != nil {
+				log.Printf("WARNING: Reloading targets failed, keeping the old list: %v", err)
+				continue
+			}
+			m.checkAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkAll runs every target in parallel, each waiting for a global slot like a batch entry
+func (m *monitor) checkAll(ctx context.Context) {
+	m.mu.RLock()
+	targets := m.targets
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t monitorTarget) {
+			defer wg.Done()
+			start := time.Now()
+			resp := t.job.run(ctx)
+			res := monitorResult{Name: t.name, Response: resp, CheckedAt: start.UTC(), Duration: durationMs(time.Since(start))}
+
+			m.mu.Lock()
+			m.results[t.name] = res
+			m.mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+}
+
+// latest returns the stored results sorted by name
+func (m *monitor) latest() []monitorResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]monitorResult, 0, len(m.results))
+	for _, r := range m.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// handleStatus lists the latest result of every scheduled target
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !authorized(r) {
+		writeError(w, http.StatusForbidden, "Auth failed")
+		return
+	}
+	if selfMonitor == nil {
+		writeError(w, http.StatusNotFound, "Self-checks are disabled, set TARGETS_FILE")
+		return
+	}
+
+	writeJSON(w, r, selfMonitor.latest())
+}
+
+// handleMetrics exposes the latest self-check results in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, http.StatusForbidden, "Auth failed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	var results []monitorResult
+	if selfMonitor != nil {
+		results = selfMonitor.latest()
+	}
+
+	var b strings.Builder
+	b.WriteString("# HELP pinger_target_up Whether the last check of the target succeeded.\n")
+	b.WriteString("# TYPE pinger_target_up gauge\n")
+	for _, res := range results {
+		up := 0
+		if res.Response.Up {
+			up = 1
+		}
+		fmt.Fprintf(&b, "pinger_target_up{%s} %d\n", metricLabels(res), up)
+	}
+	b.WriteString("# HELP pinger_target_check_duration_seconds How long the last check of the target took.\n")
+	b.WriteString("# TYPE pinger_target_check_duration_seconds gauge\n")
+	for _, res := range results {
+		fmt.Fprintf(&b, "pinger_target_check_duration_seconds{%s} %s\n", metricLabels(res), strconv.FormatFloat(res.Duration/1000, 'f', -1, 64))
+	}
+	b.WriteString("# HELP pinger_target_last_check_timestamp_seconds When the target was last checked.\n")
+	b.WriteString("# TYPE pinger_target_last_check_timestamp_seconds gauge\n")
+	for _, res := range results {
+		fmt.Fprintf(&b, "pinger_target_last_check_timestamp_seconds{%s} %d\n", metricLabels(res), res.CheckedAt.Unix())
+	}
+	b.WriteString("# HELP pinger_auth_failures_total Requests rejected for a missing or wrong key.\n")
+	b.WriteString("# TYPE pinger_auth_failures_total counter\n")
+	fmt.Fprintf(&b, "pinger_auth_failures_total %d\n", authFailures.Load())
+	io.WriteString(w, b.String())
+}
+
+// labelEscaper escapes Prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricLabels(res monitorResult) string {
+	return fmt.Sprintf(`name="%s",method="%s",host="%s"`,
+		labelEscaper.Replace(res.Name), labelEscaper.Replace(res.Response.Type), labelEscaper.Replace(res.Response.Host))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// CONNACK return codes of MQTT 3.1.1
+var mqttReturnCodes = map[byte]string{
+	0: "connection accepted",
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// MQTTResult is the result of method=mqtt
+type MQTTResult struct {
+	ConnectMs      float64 `json:"connect_ms"`            // TCP, and TLS with tls=true
+	ConnackMs      float64 `json:"connack_ms"`            // From sending CONNECT to the CONNACK
+	ReturnCode     int     `json:"return_code"`           // 0 when the broker accepted the connection
+	ReturnMessage  string  `json:"return_message"`        // e.g. "not authorized"
+	SessionPresent bool    `json:"session_present"`       // The broker kept state from an earlier session (clean_session=false)
+	TLSVersion     string  `json:"tls_version,omitempty"` // With tls=true
+}
+
+// Up requires the broker to accept the connection
+func (r MQTTResult) Up() bool { return r.ReturnCode == 0 }
+
+// mqttChecker sends an MQTT 3.1.1 CONNECT and reads the CONNACK
+type mqttChecker struct{}
+
+type mqttOptions struct {
+	tcpOptions
+	TLS          bool
+	Insecure     bool
+	ServerName   string
+	ClientID     string
+	User         string
+	Password     string
+	CleanSession bool
+}
+
+func parseMQTTOptions(p checkParams) (mqttOptions, error) {
+	opts := mqttOptions{
+		TLS:          p.Get("tls") == "true" || strings.HasPrefix(p.Host, "mqtts://"),
+		Insecure:     p.Get("insecure") == "true",
+		ClientID:     p.Get("client_id"),
+		User:         p.Get("user"),
+		Password:     p.Get("password"),
+		CleanSession: p.Get("clean_session") != "false",
+	}
+	if opts.Password != "" && opts.User == "" {
+		return opts, paramErrorf("password needs user")
+	}
+	if opts.ClientID == "" {
+		if !opts.CleanSession {
+			return opts, paramErrorf("clean_session=false needs a client_id, the broker keeps the session under it")
+		}
+		// Unique, so parallel checks don't kick each other off the broker
+		id := make([]byte, 6)
+		rand.Read(id)
+		opts.ClientID = "pinger-" + hex.EncodeToString(id)
+	}
+	if len(opts.ClientID) > 0xffff || len(opts.User) > 0xffff || len(opts.Password) > 0xffff {
+		return opts, paramErrorf("client_id, user and password must be shorter than 64 KiB")
+	}
+	opts.ServerName, _, _ = splitTarget(mqttHost(p.Host))
+
+	var err error
+	if opts.Dialer, err = p.Dialer(); err != nil {
+		return opts, err
+	}
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+func mqttHost(host string) string {
+	host = strings.TrimPrefix(host, "mqtt://")
+	return strings.TrimPrefix(host, "mqtts://")
+}
+
+// mqttAddress is host:port, port 1883 (8883 with TLS) unless given
+func mqttAddress(p checkParams, useTLS bool) string {
+	port := p.Get("port")
+	if port == "" {
+		if _, hostPort, _ := splitTarget(mqttHost(p.Host)); hostPort == "" {
+			port = "1883"
+			if useTLS {
+				port = "8883"
+			}
+		}
+	}
+	addr, _ := tcpAddress(mqttHost(p.Host), port)
+	return addr
+}
+
+func (mqttChecker) Validate(p checkParams) error {
+	_, err := parseMQTTOptions(p)
+	return err
+}
+
+func (mqttChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseMQTTOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	return checkMQTT(ctx, mqttAddress(p, opts.TLS), opts)
+}
+
+func checkMQTT(ctx context.Context, addr string, opts mqttOptions) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = directDialer
+	}
+	start := time.Now()
+	conn, err := dialTimeout(ctx, dialer, "tcp", addr, opts.ConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var res MQTTResult
+	if opts.TLS {
+		tc := tls.Client(conn, &tls.Config{RootCAs: trustedRoots, ServerName: opts.ServerName, InsecureSkipVerify: opts.Insecure})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			if ce := certError(err); ce != nil {
+				return 0, ce
+			}
+			return 0, mqttError(ctx, "TLS handshake", err)
+		}
+		res.TLSVersion = tls.VersionName(tc.ConnectionState().Version)
+		conn = tc
+	}
+	res.ConnectMs = durationMs(time.Since(start))
+
+	connackStart := time.Now()
+	if _, err := conn.Write(mqttConnectPacket(opts)); err != nil {
+		return 0, mqttError(ctx, "CONNECT", err)
+	}
+	// CONNACK: type 2 with a remaining length of 2, then the flags and the return code
+	var connack [4]byte
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		return 0, mqttError(ctx, "CONNACK", err)
+	}
+	if connack[0] != 0x20 || connack[1] != 2 {
+		return 0, fmt.Errorf("mqtt CONNACK failed: unexpected reply % x, not an MQTT broker?", connack[:])
+	}
+	res.ConnackMs = durationMs(time.Since(connackStart))
+	res.SessionPresent = connack[2]&1 == 1
+	res.ReturnCode = int(connack[3])
+	res.ReturnMessage = mqttReturnCodes[connack[3]]
+	if res.ReturnMessage == "" {
+		res.ReturnMessage = fmt.Sprintf("unknown return code %d", connack[3])
+	}
+
+	if res.ReturnCode == 0 {
+		conn.Write([]byte{0xe0, 0}) // DISCONNECT, so the broker doesn't log a lost client
+	}
+	return res, nil
+}
+
+// mqttConnectPacket builds an MQTT 3.1.1 CONNECT with a 30s keep alive
+func mqttConnectPacket(opts mqttOptions) []byte {
+	var flags byte
+	if opts.CleanSession {
+		flags |= 0x02
+	}
+	if opts.User != "" {
+		flags |= 0x80
+	}
+	if opts.Password != "" {
+		flags |= 0x40
+	}
+
+	body := mqttString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 30) // Protocol level 4 (3.1.1), flags, keep alive
+	body = mqttString(body, opts.ClientID)
+	if opts.User != "" {
+		body = mqttString(body, opts.User)
+	}
+	if opts.Password != "" {
+		body = mqttString(body, opts.Password)
+	}
+
+	packet := []byte{0x10}
+	// Remaining length: 7 bits per byte, the high bit says another byte follows
+	for n := len(body); ; {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// mqttString appends s with its two-byte length prefix
+func mqttString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// mqttError names the step that failed; one cut off by the timeout is a READ_TIMEOUT
+func mqttError(ctx context.Context, step string, err error) error {
+	err = fmt.Errorf("mqtt %s failed: %w", step, err)
+	var ne net.Error
+	if ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return &checkError{code: codeReadTimeout, err: err}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Nagios plugin states and their exit codes
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosStateNames = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosThresholds are the warn/crit params in milliseconds, 0 when unset
+type nagiosThresholds struct {
+	Warn, Crit float64
+}
+
+func parseNagiosThresholds(q url.Values) (t nagiosThresholds, err error) {
+	if t.Warn, err = nagiosThresholdParam(q, "warn"); err != nil {
+		return t, err
+	}
+	t.Crit, err = nagiosThresholdParam(q, "crit")
+	return t, err
+}
+
+func nagiosThresholdParam(q url.Values, name string) (float64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(v, "ms"), 64)
+	if err != nil || f <= 0 {
+		return 0, paramErrorf("%s must be a positive number of milliseconds", name)
+	}
+	return f, nil
+}
+
+// nagiosMetric picks the latency to report as performance data, ok is false for
+// results without one (e.g. rdap or a plain HTTP status)
+func nagiosMetric(result any) (label string, ms float64, ok bool) {
+	switch r := result.(type) {
+	case float64:
+		return "rtt", r, true
+	case PingResult:
+		if r.PingSummary != nil {
+			return "rtt", r.AvgMs, true
+		}
+	case PingStreamsResult:
+		return "rtt", r.Aggregate.AvgMs, true
+	case TCPResult:
+		return "rtt", r.ConnectMs, true
+	case HTTPResult:
+		return "time", r.TotalMs, true
+	case WSResult:
+		return "rtt", r.HandshakeMs, true
+	}
+	return "", 0, false
+}
+
+// nagiosState maps a response to a plugin state: failures are CRITICAL, a latency
+// above crit/warn or a warning from the check raises the state accordingly
+func nagiosState(resp Response, t nagiosThresholds) int {
+	if resp.Error != "" || !resp.Up {
+		return nagiosCritical
+	}
+	if _, ms, ok := nagiosMetric(resp.Result); ok {
+		if t.Crit > 0 && ms > t.Crit {
+			return nagiosCritical
+		}
+		if t.Warn > 0 && ms > t.Warn {
+			return nagiosWarning
+		}
+	}
+	if resp.Warning != "" {
+		return nagiosWarning
+	}
+	return nagiosOK
+}
+
+// nagiosHTTPStatus lets plain HTTP monitors tell CRITICAL apart without parsing the body.
+// The exact state is always in X-Nagios-Exit-Code.
+func nagiosHTTPStatus(state int) int {
+	switch state {
+	case nagiosCritical:
+		return http.StatusServiceUnavailable
+	case nagiosUnknown:
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+// formatNagios renders the status line, e.g. "PING OK - google.com: 14.2 ms | rtt=14.2ms;50;100"
+func formatNagios(resp Response, t nagiosThresholds) (state int, line string) {
+	state = nagiosState(resp, t)
+
+	var msg string
+	switch {
+	case resp.Maintenance:
+		msg = "maintenance, not checked"
+	case resp.Error != "":
+		msg = resp.Error
+	case resp.Warning != "":
+		msg = resp.Warning
+	}
+
+	label, ms, hasMetric := nagiosMetric(resp.Result)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s - %s", strings.ToUpper(resp.Type), nagiosStateNames[state], resp.Host)
+	switch {
+	case msg != "":
+		fmt.Fprintf(&b, ": %s", msg)
+	case hasMetric:
+		fmt.Fprintf(&b, ": %s ms", strconv.FormatFloat(ms, 'f', -1, 64))
+	default:
+		if status, ok := resp.Result.(statusResult); ok {
+			fmt.Fprintf(&b, ": HTTP %d", status.status)
+		}
+	}
+
+	if hasMetric && resp.Error == "" {
+		fmt.Fprintf(&b, " | %s=%sms", label, strconv.FormatFloat(ms, 'f', -1, 64))
+		if t.Warn > 0 || t.Crit > 0 {
+			fmt.Fprintf(&b, ";%s;%s", nagiosThreshold(t.Warn), nagiosThreshold(t.Crit))
+		}
+	}
+	return state, b.String()
+}
+
+func nagiosThreshold(v float64) string {
+	if v <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeNagios sends a plugin-style text response
+func writeNagios(w http.ResponseWriter, state int, line string) {
+	writeNagiosStatus(w, nagiosHTTPStatus(state), state, line)
+}
+
+// writeNagiosStatus is writeNagios with an explicit HTTP status, for requests that fail before the check
+func writeNagiosStatus(w http.ResponseWriter, status, state int, line string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Nagios-Exit-Code", strconv.Itoa(state))
+	w.WriteHeader(status)
+	fmt.Fprintln(w, line)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// nat64Prefix is what nat64=true embeds IPv4 addresses in (NAT64_PREFIX), the
+// well-known prefix of RFC 6052 unless configured
+var nat64Prefix = mustParseNAT64Prefix("64:ff9b::/96")
+
+// parseNAT64Prefix accepts an IPv6 prefix of one of the lengths RFC 6052 defines
+func parseNAT64Prefix(s string) (*net.IPNet, error) {
+	ip, prefix, err := net.ParseCIDR(s)
+	if err != nil || ip.To4() != nil {
+		return nil, fmt.Errorf("%q isn't an IPv6 prefix like 64:ff9b::/96", s)
+	}
+	switch ones, _ := prefix.Mask.Size(); ones {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return nil, fmt.Errorf("prefix length must be 32, 40, 48, 56, 64 or 96, not %d", ones)
+	}
+	if prefix.IP[8] != 0 {
+		return nil, fmt.Errorf("bits 64 to 71 of %s must be zero", s)
+	}
+	return prefix, nil
+}
+
+func mustParseNAT64Prefix(s string) *net.IPNet {
+	prefix, err := parseNAT64Prefix(s)
+	if err != nil {
+		panic(err)
+	}
+	return prefix
+}
+
+// synthesizeNAT64 embeds v4 in prefix as DNS64 would: right after the prefix, skipping
+// bits 64 to 71, which stay zero (RFC 6052 section 2.2)
+func synthesizeNAT64(prefix *net.IPNet, v4 net.IP) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP)
+	ones, _ := prefix.Mask.Size()
+	pos := ones / 8
+	for _, b := range v4.To4() {
+		if pos == 8 {
+			pos++
+		}
+		ip[pos] = b
+		pos++
+	}
+	return ip
+}
+
+// nat64Address is the IPv6 address an IPv6-only client reaches host at through NAT64:
+// its first IPv4 address in nat64Prefix
+func nat64Address(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return nil, paramErrorf("nat64 needs an IPv4 address or a name, %s is already IPv6", host)
+		}
+		return synthesizeNAT64(nat64Prefix, ip), nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		var de *net.DNSError
+		if errors.As(err, &de) && de.IsNotFound {
+			if others, oerr := net.DefaultResolver.LookupIP(ctx, "ip6", host); oerr == nil && len(others) > 0 {
+				return nil, &checkError{code: codeNoAddressInFamily, err: fmt.Errorf("%s has no IPv4 address to reach through NAT64, only IPv6", host)}
+			}
+		}
+		return nil, dnsError(err)
+	}
+	return synthesizeNAT64(nat64Prefix, ips[0]), nil
+}
+
+// nat64Dialer connects over IPv6 to the NAT64 address of the target instead of the target itself
+type nat64Dialer struct {
+	d contextDialer
+}
+
+func (n nat64Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := nat64Address(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return n.d.DialContext(ctx, "tcp6", net.JoinHostPort(ip.String(), port))
+}
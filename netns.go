@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Where `ip netns add` puts named network namespaces
+const netnsDir = "/var/run/netns"
+
+// Names accepted by the netns param (NETNS_ALLOW), empty when the feature is off
+var allowedNetns map[string]bool
+
+// parseNetnsAllow reads the comma-separated NETNS_ALLOW list
+func parseNetnsAllow(list string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func netnsNames() []string {
+	names := make([]string, 0, len(allowedNetns))
+	for name := range allowedNetns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// netnsPath checks name against NETNS_ALLOW and returns its namespace file
+func netnsPath(name string) (string, error) {
+	if len(allowedNetns) == 0 {
+		return "", fmt.Errorf("netns is disabled, set NETNS_ALLOW")
+	}
+	if !allowedNetns[name] {
+		return "", fmt.Errorf("netns %q not allowed, allowed: %s", name, strings.Join(netnsNames(), ", "))
+	}
+	return filepath.Join(netnsDir, name), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// netnsDialer opens connections from inside a network namespace. Only the socket is
+// created there, names are still resolved in the server's own namespace.
+type netnsDialer struct {
+	path string
+}
+
+func newNetnsDialer(path string) (contextDialer, error) {
+	return netnsDialer{path: path}, nil
+}
+
+func (d netnsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	// Namespaces belong to OS threads, so the goroutine must stay on this one
+	runtime.LockOSThread()
+
+	orig, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("netns: %w", err)
+	}
+	defer orig.Close()
+	target, err := os.Open(d.path)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("netns: %w", err)
+	}
+	defer target.Close()
+
+	if err := setns(target); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("netns: entering %s: %w", d.path, err)
+	}
+	// No fast fallback: its second dial would run on another goroutine, outside the namespace
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second, FallbackDelay: -1}
+	conn, dialErr := dialer.DialContext(ctx, network, addr)
+
+	if err := setns(orig); err != nil {
+		// Leave the thread locked: it's discarded when the goroutine ends, instead of
+		// running other goroutines in the wrong namespace
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, fmt.Errorf("netns: restoring namespace: %w", err)
+	}
+	runtime.UnlockOSThread()
+	return conn, dialErr
+}
+
+func setns(f *os.File) error {
+	return unix.Setns(int(f.Fd()), unix.CLONE_NEWNET)
+}
+
+// netnsUsable checks at startup that the process may switch namespaces (CAP_SYS_ADMIN),
+// by re-entering its own
+func netnsUsable() error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	self, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		return err
+	}
+	defer self.Close()
+	return setns(self)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errNetnsUnsupported = errors.New("network namespaces are only supported on Linux")
+
+func newNetnsDialer(path string) (contextDialer, error) { return nil, errNetnsUnsupported }
+
+func netnsUsable() error { return errNetnsUnsupported }
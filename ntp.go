@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Seconds from the NTP epoch (1900) to the Unix epoch
+const ntpEpochOffset = 2208988800
+
+// Skew tolerated by method=ntp unless max_skew is given
+const defaultMaxSkew = time.Second
+
+// NTPResult is the result of method=ntp
+type NTPResult struct {
+	OffsetMs  float64 `json:"offset_ms"` // Server clock minus ours; positive means ours is behind
+	DelayMs   float64 `json:"delay_ms"`  // Round trip, without the server's processing time
+	Stratum   int     `json:"stratum"`
+	RefID     string  `json:"ref_id"` // Source of a stratum 1 server (e.g. GPS), else its upstream's address
+	MaxSkewMs float64 `json:"max_skew_ms"`
+	SkewOK    bool    `json:"skew_ok"`
+	Verdict   string  `json:"verdict"` // "clock OK" or "clock drifted by 1.2s, behind the server"
+}
+
+// Up requires the offset to be within max_skew
+func (r NTPResult) Up() bool { return r.SkewOK }
+
+// ntpChecker asks an NTP server for the time (SNTP, RFC 4330) and compares it with ours
+type ntpChecker struct{}
+
+type ntpOptions struct {
+	Addr    string
+	MaxSkew time.Duration
+	Timeout time.Duration
+}
+
+func parseNTPOptions(p checkParams) (ntpOptions, error) {
+	host, hostPort, _ := splitTarget(strings.TrimPrefix(p.Host, "ntp://"))
+	port := p.Get("port")
+	if port == "" {
+		port = hostPort
+	}
+	if port == "" {
+		port = "123"
+	}
+	opts := ntpOptions{Addr: net.JoinHostPort(host, port), MaxSkew: defaultMaxSkew}
+
+	if s := p.Get("max_skew"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return opts, paramErrorf("max_skew must be a positive duration, e.g. 500ms")
+		}
+		opts.MaxSkew = d
+	}
+	timeout, _, err := p.timeouts()
+	if err != nil {
+		return opts, err
+	}
+	opts.Timeout = timeout
+	return opts, nil
+}
+
+func (ntpChecker) Validate(p checkParams) error {
+	_, err := parseNTPOptions(p)
+	return err
+}
+
+func (ntpChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseNTPOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", opts.Addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// LI 0, version 4, mode 3 (client). A random transmit timestamp, echoed back as the
+	// origin, matches the reply to the request without revealing our clock.
+	req := make([]byte, 48)
+	req[0] = 0<<6 | 4<<3 | 3
+	rand.Read(req[40:48])
+
+	t1 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, ntpError(ctx, err)
+	}
+	reply := make([]byte, 48)
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return 0, ntpError(ctx, err)
+		}
+		if n >= 48 && string(reply[24:32]) == string(req[40:48]) {
+			break
+		}
+		// Not an answer to our request, keep waiting until the deadline
+	}
+	t4 := time.Now()
+
+	if mode := reply[0] & 7; mode != 4 {
+		return 0, fmt.Errorf("ntp reply has mode %d, not a server", mode)
+	}
+	stratum := int(reply[1])
+	refID := ntpRefID(stratum, reply[12:16])
+	if stratum == 0 {
+		// Kiss-o'-Death, e.g. RATE when we ask too often
+		return 0, fmt.Errorf("ntp server refused: kiss code %s", refID)
+	}
+	if reply[0]>>6 == 3 {
+		return 0, fmt.Errorf("ntp server isn't synchronized (stratum %d)", stratum)
+	}
+
+	t2 := ntpTime(reply[32:40])
+	t3 := ntpTime(reply[40:48])
+	// Monotonic t4-t1 keeps a local clock step during the exchange out of the delay
+	offset := (t2.Sub(t1.Round(0)) + t3.Sub(t4.Round(0))) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+
+	res := NTPResult{
+		OffsetMs:  durationMs(offset),
+		DelayMs:   durationMs(max(delay, 0)),
+		Stratum:   stratum,
+		RefID:     refID,
+		MaxSkewMs: durationMs(opts.MaxSkew),
+	}
+	skew := time.Duration(math.Abs(float64(offset)))
+	res.SkewOK = skew <= opts.MaxSkew
+	if res.SkewOK {
+		res.Verdict = "clock OK"
+	} else {
+		side := "behind"
+		if offset < 0 {
+			side = "ahead of"
+		}
+		res.Verdict = fmt.Sprintf("clock drifted by %s, %s the server", skew.Round(time.Millisecond), side)
+	}
+	return res, nil
+}
+
+// ntpTime converts a 64-bit NTP timestamp: seconds since 1900 and a 32-bit fraction
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(secs, frac*1e9>>32)
+}
+
+// ntpRefID is ASCII for stratum 0 and 1 (kiss code or source), an IPv4 address above.
+// Servers with an IPv6 upstream put a hash there, which shows up as an address too.
+func ntpRefID(stratum int, b []byte) string {
+	if stratum <= 1 {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	return net.IP(b).String()
+}
+
+// ntpError gives replies that didn't arrive in time a TIMEOUT
+func ntpError(ctx context.Context, err error) error {
+	err = fmt.Errorf("ntp query failed: %w", err)
+	if ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		return &checkError{code: codeTimeout, err: err}
+	}
+	return err
+}
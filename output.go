@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Field naming of JSON responses (JSON_FIELD_NAMES): snake_case as declared, or camelCase
+var camelCaseFields bool
+
+// writeJSON encodes v like a json.Encoder would, in camelCase with JSON_FIELD_NAMES=camel
+// and indented with pretty=true
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	b, err := encodeJSON(v, r.URL.Query().Get("pretty") == "true")
+	if err != nil {
+		log.Printf("JSON encode error: %v", err)
+		return
+	}
+	w.Write(b)
+}
+
+// encodeJSON marshals v with a trailing newline, applying the field naming and optional indentation
+func encodeJSON(v any, pretty bool) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if camelCaseFields {
+		if b, err = renameFields(b, v, camelCase); err != nil {
+			return nil, err
+		}
+	}
+	if pretty {
+		var out bytes.Buffer
+		if err := json.Indent(&out, b, "", "  "); err != nil {
+			return nil, err
+		}
+		b = out.Bytes()
+	}
+	return append(b, '\n'), nil
+}
+
+// camelCase turns response_time_ms into responseTimeMs
+func camelCase(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// snakeCase turns responseTimeMs back into response_time_ms
+func snakeCase(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// renameFields rewrites the struct field names in data, the JSON of v, keeping the order of
+// fields. Map keys are data, like the hosts of a backends check or return_headers names, and
+// stay as they are; so do the keys of objects that can't be traced back to a Go value.
+func renameFields(data []byte, v any, rename func(string) string) ([]byte, error) {
+	return rewriteJSON(data, reflect.ValueOf(v), rename, nil)
+}
+
+// rewriteJSON re-encodes data, the JSON of v (may be invalid), token by token, keeping the
+// order of fields. Keys of structs go through rename and numbers through number, which gets
+// the key they're under ("" outside objects, the array's key inside one); either may be nil.
+func rewriteJSON(data []byte, v reflect.Value, rename func(string) string, number func(key string, n json.Number) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	// One entry per open object or array: whether it's an object, how many tokens it has
+	// seen, the key its values are under, and its Go value and that of the current key
+	type level struct {
+		object bool
+		n      int
+		key    string
+		val    reflect.Value
+		child  reflect.Value
+	}
+	var stack []level
+	var out bytes.Buffer
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		isKey := false
+		val := v // Go value of tok when it's a value, not a key
+		if d, ok := tok.(json.Delim); !ok || (d != '}' && d != ']') {
+			if len(stack) > 0 {
+				top := &stack[len(stack)-1]
+				switch {
+				case top.object && top.n%2 == 0:
+					isKey = true
+					if top.n > 0 {
+						out.WriteByte(',')
+					}
+				case top.object:
+					out.WriteByte(':')
+					val = top.child
+				default:
+					if top.n > 0 {
+						out.WriteByte(',')
+					}
+					val = jsonElem(top.val, top.n)
+				}
+				top.n++
+			}
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			out.WriteRune(rune(t))
+			switch t {
+			case '{', '[':
+				var key string
+				if len(stack) > 0 {
+					key = stack[len(stack)-1].key
+				}
+				stack = append(stack, level{object: t == '{', key: key, val: jsonValue(val)})
+			default:
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if isKey {
+				top := &stack[len(stack)-1]
+				top.key, top.child = t, jsonField(top.val, t)
+				if rename != nil && top.val.Kind() == reflect.Struct {
+					t = rename(t)
+				}
+			}
+			b, _ := json.Marshal(t)
+			out.Write(b)
+		case json.Number:
+			if number == nil {
+				out.WriteString(t.String())
+				break
+			}
+			var key string
+			if len(stack) > 0 {
+				key = stack[len(stack)-1].key
+			}
+			out.WriteString(number(key, t))
+		case bool, nil:
+			b, _ := json.Marshal(t)
+			out.Write(b)
+		}
+	}
+}
+
+// jsonValue follows pointers, interfaces and roundedResult to the value that gets encoded
+func jsonValue(v reflect.Value) reflect.Value {
+	for v.IsValid() {
+		switch {
+		case v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer:
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		case v.Type() == reflect.TypeOf(roundedResult{}):
+			v = v.Field(0)
+		default:
+			return v
+		}
+	}
+	return v
+}
+
+// jsonField is the Go value encoded under name in the struct or map v
+func jsonField(v reflect.Value, name string) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			return v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		}
+	case reflect.Struct:
+		return structField(v, name)
+	}
+	return reflect.Value{}
+}
+
+// structField finds the field encoding/json names name, direct fields before embedded ones
+func structField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || tag == "-" || (f.Anonymous && tag == "") {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return v.Field(i)
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			if embedded := jsonValue(v.Field(i)); embedded.Kind() == reflect.Struct {
+				if found := structField(embedded, name); found.IsValid() {
+					return found
+				}
+			}
+		}
+	}
+	return reflect.Value{}
+}
+
+// jsonElem is element i of the slice or array v
+func jsonElem(v reflect.Value, i int) reflect.Value {
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && i < v.Len() {
+		return v.Index(i)
+	}
+	return reflect.Value{}
+}
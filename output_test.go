@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type renameInner struct {
+	TotalMs float64           `json:"total_ms"`
+	Headers map[string]string `json:"return_headers,omitempty"`
+}
+
+type renameEmbedded struct {
+	ErrorCode string `json:"error_code"`
+}
+
+type renameOuter struct {
+	renameEmbedded
+	Inner   renameInner            `json:"inner_result"`
+	Items   []renameInner          `json:"list_items"`
+	Ptr     *renameInner           `json:"ptr_result,omitempty"`
+	Skipped string                 `json:"skipped_field,omitempty"`
+	ByHost  map[string]renameInner `json:"by_host"`
+	Any     any                    `json:"any_value"`
+}
+
+func TestRenameFields(t *testing.T) {
+	v := renameOuter{
+		renameEmbedded: renameEmbedded{ErrorCode: "DNS_ERROR"},
+		Inner:          renameInner{TotalMs: 1.5, Headers: map[string]string{"x_cache_status": "HIT"}},
+		Items:          []renameInner{{TotalMs: 2}},
+		ByHost:         map[string]renameInner{"host_a": {TotalMs: 3}},
+		Any:            map[string]any{"raw_key": renameInner{TotalMs: 4}},
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := renameFields(data, v, camelCase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Map keys stay as they are, struct fields below them are still renamed
+	want := `{"errorCode":"DNS_ERROR","innerResult":{"totalMs":1.5,"returnHeaders":{"x_cache_status":"HIT"}},` +
+		`"listItems":[{"totalMs":2}],"byHost":{"host_a":{"totalMs":3}},"anyValue":{"raw_key":{"totalMs":4}}}`
+	if string(got) != want {
+		t.Errorf("renameFields =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenameFieldsUntraced(t *testing.T) {
+	// Without a Go value nothing is known to be a struct, so nothing is renamed
+	data := []byte(`{"error_code":"X","nested":{"total_ms":1}}`)
+	got, err := renameFields(data, nil, camelCase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("renameFields = %s, want it unchanged", got)
+	}
+}
+
+func TestResponseMarshalFields(t *testing.T) {
+	defer func(old bool) { camelCaseFields = old }(camelCaseFields)
+	camelCaseFields = true
+
+	resp := Response{
+		Host:      "example.com",
+		Type:      "https",
+		Result:    renameInner{TotalMs: 12.3456, Headers: map[string]string{"cf_ray": "abc"}},
+		Up:        true,
+		ErrorCode: "",
+		precision: 1,
+	}
+	// Either naming selects the field, the result is rounded to precision
+	for _, spec := range []string{"result,error_code,up", "result,errorCode,up"} {
+		got, err := encodeJSON(selectFields(resp, spec), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"result":{"totalMs":12.3,"returnHeaders":{"cf_ray":"abc"}},"up":true}` + "\n"
+		if string(got) != want {
+			t.Errorf("fields=%s: %s, want %s", spec, got, want)
+		}
+	}
+
+	got, err := encodeJSON(resp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"host":"example.com","type":"https","result":{"totalMs":12.3,"returnHeaders":{"cf_ray":"abc"}},"up":true}` + "\n"
+	if string(got) != want {
+		t.Errorf("encodeJSON = %s, want %s", got, want)
+	}
+}
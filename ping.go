@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pingOptions controls the shape of the ping result
+type pingOptions struct {
+	PerPacket bool   // Include per-packet RTTs (per_packet=true)
+	FullStats bool   // Include min/avg/max/loss summary (stats=full)
+	Family    string // "4", "6" or "" to let ping decide
+	TTL       int    // Outgoing IP TTL / hop limit (ttl), 0 for the system default
+	NAT64     bool   // Ping the host's NAT64 address (nat64=true) over IPv6
+	// How long to wait for each reply (timeout, ping -W)
+	PacketTimeout time.Duration
+	// Stop pinging after this long however many replies came back (deadline, ping -w), 0 for none
+	Deadline time.Duration
+	// Hex bytes repeated to fill the payload (pattern, ping -p), e.g. ff or 55aa
+	Pattern string
+	// Sustained mode: ping once a second for this long instead of sending pingCount packets
+	Duration time.Duration
+	// Run this many pings at once, each sending StreamPackets (streams, stream_packets), 0 for one
+	Streams       int
+	StreamPackets int
+}
+
+// PingPacket is a single echo request/reply in per-packet mode
+type PingPacket struct {
+	Seq      int     `json:"seq"`
+	RTTMs    float64 `json:"rtt_ms"`
+	Received bool    `json:"received"`
+}
+
+// PingSummary holds the aggregate statistics reported by ping
+type PingSummary struct {
+	Transmitted int     `json:"transmitted"`
+	Received    int     `json:"received"`
+	LossPercent float64 `json:"loss_percent"`
+	MinMs       float64 `json:"min_ms"`
+	AvgMs       float64 `json:"avg_ms"`
+	MaxMs       float64 `json:"max_ms"`
+}
+
+// PingPercentiles are the RTT percentiles of a sustained ping
+type PingPercentiles struct {
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+// PingResult is returned instead of the plain average when detailed output is requested
+type PingResult struct {
+	*PingSummary                  // Present with stats=full and in sustained mode
+	*PingPercentiles              // Only in sustained mode
+	Packets          []PingPacket `json:"packets,omitempty"`
+}
+
+const (
+	pingCount = 3
+	// Upper bound for duration= and deadline=, keeps a single request from holding a slot for long
+	maxPingDuration = 60 * time.Second
+
+	defaultPingPacketTimeout = 2 * time.Second
+	maxPingPacketTimeout     = 10 * time.Second
+)
+
+var (
+	// Parse Linux ping output
+	pingCountsRe = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingPacketRe = regexp.MustCompile(`(?m)icmp_seq=(\d+).*time=(\d+(?:\.\d+)?) ms`)
+	// ping -p takes up to 16 bytes of fill pattern
+	pingPatternRe = regexp.MustCompile(`^[0-9a-fA-F]{1,32}$`)
+	// "From 10.0.0.1 icmp_seq=1 Time to live exceeded", optionally "From gw.lan (10.0.0.1) ..."
+	pingTTLExceededRe = regexp.MustCompile(`(?i)from (\S+?)(?: \((\S+)\))?:? (?:icmp_seq=\d+ )?Time to live exceeded`)
+)
+
+const codePingBinaryMissing = "PING_BINARY_MISSING" // No ping in PATH, a problem of this server rather than the target
+
+// errPingMissing explains how to fix a missing ping binary
+var errPingMissing = &checkError{
+	code: codePingBinaryMissing,
+	err:  errors.New("ping binary not found in PATH: install iputils (apk add iputils, apt install iputils-ping) or set DISABLE_PING=true"),
+}
+
+// pingExecError is errPingMissing when ping couldn't be started because it doesn't exist
+func pingExecError(err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return errPingMissing
+	}
+	return nil
+}
+
+// Reject method=ping outright, for hosts without the ping binary or CAP_NET_RAW (DISABLE_PING)
+var pingDisabled bool
+
+// pingUsable checks at startup that the ping binary exists and may send ICMP, by pinging loopback
+func pingUsable() error {
+	if _, err := exec.LookPath("ping"); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "ping", "-c", "1", "-W", "1", "127.0.0.1").CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// pingChecker runs the system ping binary
+type pingChecker struct{}
+
+func (pingChecker) Validate(p checkParams) error {
+	_, err := parsePingOptions(p)
+	return err
+}
+
+// MaxDuration lets the handler extend its write deadline for sustained pings and long packet timeouts
+func (pingChecker) MaxDuration(p checkParams) time.Duration {
+	opts, err := parsePingOptions(p)
+	if err != nil {
+		return 0
+	}
+	if opts.Streams > 0 {
+		return streamsDuration(opts)
+	}
+	if opts.Duration > 0 {
+		return opts.Duration
+	}
+	// One packet per second, then the wait for the last reply
+	d := (pingCount-1)*time.Second + opts.PacketTimeout
+	if opts.Deadline > 0 {
+		d = min(d, opts.Deadline)
+	}
+	return d
+}
+
+func (pingChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parsePingOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	host := pingHost(p.Host)
+	if opts.NAT64 {
+		ip, err := nat64Address(ctx, host)
+		if err != nil {
+			return 0, err
+		}
+		host = ip.String()
+	} else if err := checkFamily(ctx, host, opts.Family); err != nil {
+		return 0, err
+	}
+	if opts.Streams > 0 {
+		return checkPingStreams(ctx, host, opts)
+	}
+	return checkPing(ctx, host, opts)
+}
+
+func parsePingOptions(p checkParams) (pingOptions, error) {
+	opts := pingOptions{
+		PerPacket: p.Get("per_packet") == "true",
+		FullStats: p.Get("stats") == "full",
+		Family:    p.Get("family"),
+		NAT64:     p.Get("nat64") == "true",
+	}
+
+	if d := p.Get("duration"); d != "" {
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return opts, paramErrorf("invalid duration %q", d)
+		}
+		if dur < time.Second || dur > maxPingDuration {
+			return opts, paramErrorf("duration must be between 1s and %s", maxPingDuration)
+		}
+		opts.Duration = dur.Round(time.Second) // ping -w takes whole seconds
+	}
+
+	// Waits are passed to ping in whole seconds
+	timeout, err := p.durationParam("timeout", defaultPingPacketTimeout)
+	if err != nil {
+		return opts, err
+	}
+	if timeout < time.Second || timeout > maxPingPacketTimeout {
+		return opts, paramErrorf("timeout must be between 1s and %s per packet", maxPingPacketTimeout)
+	}
+	opts.PacketTimeout = timeout.Round(time.Second)
+
+	if d := p.Get("deadline"); d != "" {
+		if opts.Duration > 0 {
+			return opts, paramErrorf("deadline can't be combined with duration, which already sets it")
+		}
+		deadline, err := p.durationParam("deadline", 0)
+		if err != nil {
+			return opts, err
+		}
+		if deadline < time.Second || deadline > maxPingDuration {
+			return opts, paramErrorf("deadline must be between 1s and %s", maxPingDuration)
+		}
+		opts.Deadline = deadline.Round(time.Second)
+	}
+
+	if pattern := p.Get("pattern"); pattern != "" {
+		pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "0x"), "0X")
+		if !pingPatternRe.MatchString(pattern) {
+			return opts, paramErrorf("pattern must be 1 to 32 hex digits, e.g. ff, 00 or 55aa")
+		}
+		opts.Pattern = strings.ToLower(pattern)
+	}
+
+	if t := p.Get("ttl"); t != "" {
+		ttl, err := strconv.Atoi(t)
+		if err != nil || ttl < 1 || ttl > 255 {
+			return opts, paramErrorf("ttl must be between 1 and 255")
+		}
+		opts.TTL = ttl
+	}
+
+	if s := p.Get("streams"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 2 || n > maxPingStreams {
+			return opts, paramErrorf("streams must be between 2 and %d", maxPingStreams)
+		}
+		if opts.Duration > 0 || opts.PerPacket {
+			return opts, paramErrorf("streams can't be combined with duration or per_packet")
+		}
+		opts.Streams = n
+		opts.StreamPackets = defaultStreamPackets
+	}
+	if s := p.Get("stream_packets"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPingStreamPackets {
+			return opts, paramErrorf("stream_packets must be between 1 and %d", maxPingStreamPackets)
+		}
+		if opts.Streams == 0 {
+			return opts, paramErrorf("stream_packets needs streams")
+		}
+		opts.StreamPackets = n
+	}
+	if opts.Streams*opts.StreamPackets > maxPingStreamsTotal {
+		return opts, paramErrorf("streams times stream_packets must be at most %d", maxPingStreamsTotal)
+	}
+
+	isV6 := strings.Contains(pingHost(p.Host), ":")
+	switch {
+	case opts.Family != "" && opts.Family != "4" && opts.Family != "6":
+		return opts, paramErrorf("family must be 4 or 6")
+	case opts.Family == "4" && isV6:
+		return opts, paramErrorf("family=4 requested for an IPv6 address")
+	case opts.NAT64 && isV6:
+		return opts, paramErrorf("nat64 needs an IPv4 address or a name, %s is already IPv6", pingHost(p.Host))
+	case opts.NAT64 && opts.Family == "4":
+		return opts, paramErrorf("nat64 pings over IPv6, it can't be combined with family=4")
+	case opts.NAT64 || isV6:
+		opts.Family = "6" // An IPv6 literal or NAT64 address always needs ICMPv6
+	}
+	return opts, nil
+}
+
+// pingHost strips the brackets from "[2001:db8::1]"
+func pingHost(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// Ping errors meaning the server has no working IPv6, as opposed to an unreachable host
+var noIPv6Output = []string{
+	"Address family not supported",
+	"Address family for hostname not supported",
+	"Network is unreachable",
+	"Cannot assign requested address",
+}
+
+func checkPing(ctx context.Context, host string, opts pingOptions) (any, error) {
+	sustained := opts.Duration > 0
+
+	wait := strconv.Itoa(int(opts.PacketTimeout.Seconds()))
+	args := []string{"-c", strconv.Itoa(pingCount), "-W", wait}
+	if sustained {
+		// Keep sending until the deadline, one packet per second
+		args = []string{"-w", strconv.Itoa(int(opts.Duration.Seconds())), "-i", "1", "-W", wait}
+	} else if opts.Deadline > 0 {
+		// Still pingCount packets, but ping gives up on the rest when the deadline passes
+		args = append(args, "-w", strconv.Itoa(int(opts.Deadline.Seconds())))
+	}
+	if !opts.PerPacket && !sustained && opts.TTL == 0 {
+		// Per-packet lines are only needed in per-packet and sustained mode, and for time-exceeded replies
+		args = append(args, "-q")
+	}
+	args = append(append(args, pingExtraArgs(opts)...), host)
+
+	// Use CommandContext to cancel ping if user request is cancelled. SIGINT makes
+	// ping print its statistics, so a cut-short ping still reports what it got.
+	cmd := exec.CommandContext(ctx, "ping", args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if missing := pingExecError(err); missing != nil {
+		return 0, missing
+	}
+
+	if err != nil && ctx.Err() != nil {
+		if summary, perr := parsePingSummary(string(output)); perr == nil {
+			partial := &checkError{code: codeTimeout, err: fmt.Errorf("ping stopped after %d packets: %v", summary.Transmitted, ctx.Err())}
+			return pingResult(string(output), summary, opts), partialError{partial}
+		}
+	}
+	if err != nil {
+		// With a deadline ping exits 1 if fewer than -c replies came back in time; those that did still count
+		if summary, perr := parsePingSummary(string(output)); perr == nil && opts.Deadline > 0 && summary.Received > 0 {
+			return pingResult(string(output), summary, opts), nil
+		}
+		if opts.TTL > 0 {
+			if m := pingTTLExceededRe.FindStringSubmatch(string(output)); m != nil {
+				from := m[1]
+				if m[2] != "" {
+					from = m[2]
+				}
+				return 0, &checkError{code: codeTTLExceeded, err: fmt.Errorf("ping failed: ttl %d exceeded at %s", opts.TTL, from)}
+			}
+		}
+		if opts.Family == "6" {
+			for _, msg := range noIPv6Output {
+				if strings.Contains(string(output), msg) {
+					return 0, fmt.Errorf("ping failed: IPv6 is not available on this server")
+				}
+			}
+		}
+		return 0, fmt.Errorf("ping failed: host unreachable or timeout")
+	}
+
+	summary, err := parsePingSummary(string(output))
+	if err != nil {
+		return 0, err
+	}
+	return pingResult(string(output), summary, opts), nil
+}
+
+// pingExtraArgs are the ttl, pattern and family flags, shared by every ping mode
+func pingExtraArgs(opts pingOptions) []string {
+	var args []string
+	if opts.TTL > 0 {
+		args = append(args, "-t", strconv.Itoa(opts.TTL))
+	}
+	if opts.Pattern != "" {
+		args = append(args, "-p", opts.Pattern)
+	}
+	if opts.Family != "" {
+		args = append(args, "-"+opts.Family)
+	}
+	return args
+}
+
+// pingResult shapes the parsed output as requested by opts
+func pingResult(output string, summary *PingSummary, opts pingOptions) any {
+	sustained := opts.Duration > 0
+	if !opts.PerPacket && !opts.FullStats && !sustained {
+		return summary.AvgMs
+	}
+
+	count := pingCount
+	if sustained || summary.Transmitted < count {
+		// Sustained and cut-short pings sent as many as they had time for
+		count = summary.Transmitted
+	}
+	packets := parsePingPackets(output, count)
+
+	res := PingResult{}
+	if opts.FullStats || sustained {
+		res.PingSummary = summary
+	}
+	if sustained {
+		res.PingPercentiles = pingPercentiles(packets)
+	}
+	if opts.PerPacket {
+		res.Packets = packets
+	}
+	return res
+}
+
+// pingPercentiles uses the nearest-rank method over received packets
+func pingPercentiles(packets []PingPacket) *PingPercentiles {
+	var rtts []float64
+	for _, p := range packets {
+		if p.Received {
+			rtts = append(rtts, p.RTTMs)
+		}
+	}
+	if len(rtts) == 0 {
+		return &PingPercentiles{}
+	}
+	sort.Float64s(rtts)
+	return &PingPercentiles{P50Ms: nearestRank(rtts, 50), P90Ms: nearestRank(rtts, 90), P95Ms: nearestRank(rtts, 95), P99Ms: nearestRank(rtts, 99)}
+}
+
+// parsePingPackets builds one entry per sent packet, marking missing sequence numbers as lost
+func parsePingPackets(output string, count int) []PingPacket {
+	packets := make([]PingPacket, count)
+	for i := range packets {
+		packets[i].Seq = i + 1 // iputils numbers packets from 1
+	}
+
+	for _, m := range pingPacketRe.FindAllStringSubmatch(output, -1) {
+		seq, err := strconv.Atoi(m[1])
+		if err != nil || seq < 1 || seq > count {
+			continue
+		}
+		rtt, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			continue
+		}
+		packets[seq-1].RTTMs = rtt
+		packets[seq-1].Received = true
+	}
+	return packets
+}
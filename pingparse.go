@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"runtime"
+	"strconv"
+)
+
+// pingPattern extracts min/avg/max from the ping summary using named groups
+type pingPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Matches iputils "rtt min/avg/max/mdev = 13.9/14.2/14.5/0.2 ms",
+// BusyBox "round-trip min/avg/max = 1.2/1.3/1.4 ms" and macOS "round-trip min/avg/max/stddev = ..."
+var unixPingPattern = pingPattern{"unix", regexp.MustCompile(`= (?P<min>\d+(?:\.\d+)?)/(?P<avg>\d+(?:\.\d+)?)/(?P<max>\d+(?:\.\d+)?)`)}
+
+// Default patterns per OS, tried in order
+var defaultPingPatterns = map[string][]pingPattern{
+	"linux":  {unixPingPattern},
+	"darwin": {unixPingPattern},
+	// "Minimum = 13ms, Maximum = 15ms, Average = 14ms"
+	"windows": {
+		{"windows", regexp.MustCompile(`Minimum = (?P<min>\d+)ms, Maximum = (?P<max>\d+)ms, Average = (?P<avg>\d+)ms`)},
+	},
+}
+
+var pingPatterns []pingPattern
+
+// initPingPatterns puts the custom PING_PARSE_REGEX (if valid) in front of the OS defaults
+func initPingPatterns(custom string) {
+	pingPatterns = nil
+
+	if custom != "" {
+		re, err := regexp.Compile(custom)
+		switch {
+		case err != nil:
+			log.Printf("WARNING: Invalid PING_PARSE_REGEX: %v, using defaults", err)
+		case re.SubexpIndex("avg") < 0:
+			log.Printf("WARNING: PING_PARSE_REGEX has no (?P<avg>...) group, using defaults")
+		default:
+			pingPatterns = append(pingPatterns, pingPattern{"custom", re})
+		}
+	}
+
+	defaults, ok := defaultPingPatterns[runtime.GOOS]
+	if !ok {
+		defaults = defaultPingPatterns["linux"]
+	}
+	pingPatterns = append(pingPatterns, defaults...)
+}
+
+func parsePingSummary(output string) (*PingSummary, error) {
+	for _, p := range pingPatterns {
+		matches := p.re.FindStringSubmatch(output)
+		if matches == nil {
+			continue
+		}
+
+		summary := &PingSummary{}
+		fields := map[string]*float64{"min": &summary.MinMs, "avg": &summary.AvgMs, "max": &summary.MaxMs}
+		for name, dst := range fields {
+			idx := p.re.SubexpIndex(name)
+			if idx < 0 || matches[idx] == "" {
+				continue // min/max are optional in custom patterns
+			}
+			val, err := strconv.ParseFloat(matches[idx], 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse error: %w", err)
+			}
+			*dst = val
+		}
+		// Check for "0" in case of bad parse
+		if summary.AvgMs <= 0 {
+			return nil, fmt.Errorf("invalid ping result: %v", summary.AvgMs)
+		}
+		debugf("ping output parsed with %s pattern", p.name)
+
+		if m := pingCountsRe.FindStringSubmatch(output); len(m) == 3 {
+			summary.Transmitted, _ = strconv.Atoi(m[1])
+			summary.Received, _ = strconv.Atoi(m[2])
+			if summary.Transmitted > 0 {
+				summary.LossPercent = float64(summary.Transmitted-summary.Received) / float64(summary.Transmitted) * 100
+			}
+		}
+		return summary, nil
+	}
+
+	debugf("no ping pattern matched output: %q", output)
+	return nil, fmt.Errorf("could not parse ping output")
+}
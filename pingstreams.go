@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Bounds for streams=, so a stress test of a path can't turn into a flood
+const (
+	maxPingStreams        = 8
+	maxPingStreamPackets  = 50  // Per stream (stream_packets)
+	maxPingStreamsTotal   = 200 // All streams together
+	defaultStreamPackets  = 10
+	pingStreamInterval    = 200 * time.Millisecond // The shortest ping -i allows without root
+	pingStreamIntervalArg = "0.2"
+)
+
+// PingStream is one of the concurrent pings of streams=
+type PingStream struct {
+	Stream int `json:"stream"`
+	PingSummary
+	Error string `json:"error,omitempty"`
+
+	missing bool // The ping binary doesn't exist
+}
+
+// PingStreamsResult is the result of a ping with streams=
+type PingStreamsResult struct {
+	Aggregate PingSummary  `json:"aggregate"` // All streams' packets together
+	PerStream []PingStream `json:"per_stream"`
+}
+
+// streamsDuration is how long the streams of opts may run, for the write deadline
+func streamsDuration(opts pingOptions) time.Duration {
+	d := time.Duration(opts.StreamPackets)*pingStreamInterval + opts.PacketTimeout
+	if opts.Deadline > 0 {
+		d = min(d, opts.Deadline)
+	}
+	return d
+}
+
+// checkPingStreams runs opts.Streams pings of the same host at once and sums them up
+func checkPingStreams(ctx context.Context, host string, opts pingOptions) (any, error) {
+	res := PingStreamsResult{PerStream: make([]PingStream, opts.Streams)}
+	var wg sync.WaitGroup
+	for i := range res.PerStream {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res.PerStream[i] = runPingStream(ctx, host, opts, i+1)
+		}(i)
+	}
+	wg.Wait()
+
+	agg := &res.Aggregate
+	var rttSum float64
+	for _, s := range res.PerStream {
+		agg.Transmitted += s.Transmitted
+		agg.Received += s.Received
+		if s.Received == 0 {
+			continue
+		}
+		rttSum += s.AvgMs * float64(s.Received)
+		if agg.MinMs == 0 || s.MinMs < agg.MinMs {
+			agg.MinMs = s.MinMs
+		}
+		agg.MaxMs = max(agg.MaxMs, s.MaxMs)
+	}
+	if res.PerStream[0].missing {
+		return 0, errPingMissing
+	}
+	if agg.Received == 0 {
+		return 0, fmt.Errorf("ping failed: no replies on any of %d streams", opts.Streams)
+	}
+	agg.AvgMs = math.Round(rttSum/float64(agg.Received)*1000) / 1000
+	agg.LossPercent = float64(agg.Transmitted-agg.Received) / float64(agg.Transmitted) * 100
+	return res, nil
+}
+
+func runPingStream(ctx context.Context, host string, opts pingOptions, n int) PingStream {
+	stream := PingStream{Stream: n}
+	args := []string{"-c", strconv.Itoa(opts.StreamPackets), "-i", pingStreamIntervalArg, "-W", strconv.Itoa(int(opts.PacketTimeout.Seconds())), "-q"}
+	if opts.Deadline > 0 {
+		args = append(args, "-w", strconv.Itoa(int(opts.Deadline.Seconds())))
+	}
+	args = append(append(args, pingExtraArgs(opts)...), host)
+
+	cmd := exec.CommandContext(ctx, "ping", args...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if missing := pingExecError(err); missing != nil {
+		stream.Error, stream.missing = missing.Error(), true
+		return stream
+	}
+
+	if summary, perr := parsePingSummary(string(output)); perr == nil {
+		stream.PingSummary = *summary
+		return stream
+	}
+	// No RTT line when nothing came back, but the counts are still there
+	stream.Transmitted = opts.StreamPackets
+	if m := pingCountsRe.FindStringSubmatch(string(output)); len(m) == 3 {
+		stream.Transmitted, _ = strconv.Atoi(m[1])
+		stream.Received, _ = strconv.Atoi(m[2])
+	}
+	if stream.Transmitted > 0 {
+		stream.LossPercent = float64(stream.Transmitted-stream.Received) / float64(stream.Transmitted) * 100
+	}
+	stream.Error = "ping failed: host unreachable or timeout"
+	if err == nil {
+		stream.Error = "could not parse ping output"
+	}
+	return stream
+}
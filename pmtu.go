@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IP plus ICMP header bytes on top of the ping payload
+const (
+	pmtuOverheadV4 = 28
+	pmtuOverheadV6 = 48
+)
+
+const (
+	defaultPMTUMax     = 1500
+	maxPMTUMax         = 9000 // Jumbo frames
+	defaultPMTUTimeout = 20 * time.Second
+)
+
+// PMTUResult is the result of method=pmtu
+type PMTUResult struct {
+	MTU          int `json:"mtu"`           // Largest packet that got through unfragmented
+	PayloadBytes int `json:"payload_bytes"` // Its ICMP payload, what ping -s takes
+	Probes       int `json:"probes"`
+}
+
+// pmtuChecker finds the path MTU with don't-fragment pings of varying size
+type pmtuChecker struct{}
+
+type pmtuOptions struct {
+	Family  string
+	Max     int // Largest MTU tried (max_mtu)
+	Timeout time.Duration
+}
+
+func parsePMTUOptions(p checkParams) (pmtuOptions, error) {
+	opts := pmtuOptions{Family: p.Get("family"), Max: defaultPMTUMax}
+	if s := p.Get("max_mtu"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 576 || n > maxPMTUMax {
+			return opts, paramErrorf("max_mtu must be between 576 and %d", maxPMTUMax)
+		}
+		opts.Max = n
+	}
+
+	isV6 := strings.Contains(pingHost(p.Host), ":")
+	switch {
+	case opts.Family != "" && opts.Family != "4" && opts.Family != "6":
+		return opts, paramErrorf("family must be 4 or 6")
+	case opts.Family == "4" && isV6:
+		return opts, paramErrorf("family=4 requested for an IPv6 address")
+	case isV6:
+		opts.Family = "6"
+	}
+	if opts.Family == "6" && opts.Max < 1280 {
+		return opts, paramErrorf("max_mtu must be at least 1280 for IPv6")
+	}
+
+	timeout, err := p.durationParam("timeout", defaultPMTUTimeout)
+	if err != nil {
+		return opts, err
+	}
+	opts.Timeout = min(timeout, maxTimeout)
+	return opts, nil
+}
+
+func (pmtuChecker) Validate(p checkParams) error {
+	_, err := parsePMTUOptions(p)
+	return err
+}
+
+// MaxDuration lets the handler extend its write deadline, the default timeout is above the usual one
+func (pmtuChecker) MaxDuration(p checkParams) time.Duration {
+	opts, err := parsePMTUOptions(p)
+	if err != nil {
+		return 0
+	}
+	return opts.Timeout
+}
+
+func (pmtuChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parsePMTUOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	host := pingHost(p.Host)
+	if err := checkFamily(ctx, host, opts.Family); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	return checkPMTU(ctx, host, opts)
+}
+
+// checkPMTU binary-searches the payload size between the IPv4/IPv6 minimum MTU and opts.Max.
+// A timeout partway returns the largest size confirmed so far as a partial result.
+func checkPMTU(ctx context.Context, host string, opts pmtuOptions) (any, error) {
+	overhead, minMTU := pmtuOverheadV4, 68
+	if opts.Family == "6" {
+		overhead, minMTU = pmtuOverheadV6, 1280
+	}
+	lo, hi := minMTU-overhead, opts.Max-overhead
+
+	res := PMTUResult{}
+	ok, err := pmtuProbe(ctx, host, lo, opts.Family)
+	res.Probes++
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("pmtu failed: host unreachable or timeout even with %d byte packets", lo+overhead)
+	}
+
+	// lo always got through; find the largest payload up to hi that does
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		ok, err := pmtuProbe(ctx, host, mid, opts.Family)
+		if err != nil {
+			res.MTU, res.PayloadBytes = lo+overhead, lo
+			return res, partialError{&checkError{code: codeTimeout, err: fmt.Errorf("pmtu search stopped after %d probes: %v", res.Probes, err)}}
+		}
+		res.Probes++
+		if ok {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	res.MTU, res.PayloadBytes = lo+overhead, lo
+	return res, nil
+}
+
+// pmtuProbe sends don't-fragment pings with size bytes of payload. Two packets are sent so a
+// single lost one isn't mistaken for a packet that's too big. err is set once ctx is done.
+func pmtuProbe(ctx context.Context, host string, size int, family string) (bool, error) {
+	args := []string{"-c", "2", "-i", "0.2", "-W", "1", "-M", "do", "-s", strconv.Itoa(size), "-q"}
+	if family != "" {
+		args = append(args, "-"+family)
+	}
+	args = append(args, host)
+	err := exec.CommandContext(ctx, "ping", args...).Run()
+	if missing := pingExecError(err); missing != nil {
+		return false, missing
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	return err == nil, nil
+}
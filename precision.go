@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Decimal places of latencies in responses (precision)
+const (
+	defaultPrecision = 3 // What ms() measures to anyway
+	maxPrecision     = 3 // Latencies are measured to 3 decimals, more would add nothing
+)
+
+// roundedResult marshals a result with its latencies (a plain number, *_ms fields)
+// rounded to places decimals. Other numbers, like a status or a loss percentage, are kept.
+type roundedResult struct {
+	v      any
+	places int
+}
+
+func (r roundedResult) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.v)
+	if err != nil {
+		return nil, err
+	}
+	scale := math.Pow10(r.places)
+	return rewriteJSON(data, reflect.Value{}, nil, func(key string, n json.Number) string {
+		s := n.String()
+		if (key != "" && !strings.HasSuffix(key, "_ms")) || !strings.ContainsAny(s, ".eE") {
+			return s
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return s
+		}
+		return strconv.FormatFloat(math.Round(f*scale)/scale, 'f', -1, 64)
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// publisher sends check results to a message broker. Publish must not block.
+type publisher interface {
+	Publish(resp Response)
+}
+
+// noopPublisher is used when PUBLISH_URL is unset
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(Response) {}
+
+var resultPublisher publisher = noopPublisher{}
+
+// multiPublisher sends every result to each of several publishers (PUBLISH_URL and PUSHGATEWAY_URL)
+type multiPublisher []publisher
+
+func (m multiPublisher) Publish(resp Response) {
+	for _, p := range m {
+		p.Publish(resp)
+	}
+}
+
+// Results waiting to be sent; when the broker can't keep up, newer ones are dropped
+const publishQueueSize = 1000
+
+// newPublisher picks the broker by the scheme of PUBLISH_URL
+func newPublisher(rawURL, subject string) (publisher, error) {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid subject %q", subject)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "nats":
+		if u.Host == "" {
+			return nil, fmt.Errorf("nats URL needs a host, e.g. nats://localhost:4222")
+		}
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "4222")
+		}
+		p := &natsPublisher{addr: u.Host, user: u.User, subject: subject, queue: make(chan []byte, publishQueueSize)}
+		go p.run()
+		return p, nil
+	}
+	return nil, fmt.Errorf("unsupported scheme %q, supported: nats", u.Scheme)
+}
+
+// natsPublisher speaks just enough of the NATS client protocol to publish:
+// CONNECT, PUB, and PONG in answer to the server's PINGs
+type natsPublisher struct {
+	addr    string
+	user    *url.Userinfo
+	subject string
+	queue   chan []byte
+	dropped atomic.Int64
+}
+
+func (p *natsPublisher) Publish(resp Response) {
+	data, err := encodeJSON(resp, false)
+	if err != nil {
+		return
+	}
+	data = data[:len(data)-1] // No trailing newline inside a message
+	select {
+	case p.queue <- data:
+	default:
+		if p.dropped.Add(1)%publishQueueSize == 1 {
+			log.Printf("WARNING: publish queue full, %d results dropped so far", p.dropped.Load())
+		}
+	}
+}
+
+// run keeps a connection to the server and sends queued results, reconnecting after errors
+func (p *natsPublisher) run() {
+	backoff := time.Second
+	for {
+		conn, err := p.connect()
+		if err != nil {
+			log.Printf("WARNING: publish: connecting to NATS at %s failed: %v", p.addr, err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		err = p.send(conn)
+		conn.Close()
+		log.Printf("WARNING: publish: NATS connection lost: %v", err)
+	}
+}
+
+// natsConn serializes writes from the sender and the PING handler
+type natsConn struct {
+	net.Conn
+	mu     sync.Mutex
+	failed chan error
+}
+
+func (c *natsConn) write(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.Write([]byte(s))
+	return err
+}
+
+func (p *natsPublisher) connect() (*natsConn, error) {
+	raw, err := net.DialTimeout("tcp", p.addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn := &natsConn{Conn: raw, failed: make(chan error, 1)}
+	r := bufio.NewReader(raw)
+
+	raw.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		raw.Close()
+		return nil, fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	if info.TLSRequired {
+		raw.Close()
+		return nil, fmt.Errorf("server requires TLS, which isn't supported")
+	}
+	raw.SetReadDeadline(time.Time{})
+
+	opts := map[string]any{"verbose": false, "pedantic": false, "name": "pinger"}
+	if p.user != nil {
+		opts["user"] = p.user.Username()
+		if pass, ok := p.user.Password(); ok {
+			opts["pass"] = pass
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if err := conn.write("CONNECT " + string(connect) + "\r\n"); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	go conn.readLoop(r)
+	return conn, nil
+}
+
+// readLoop answers PINGs and reports errors from the server, e.g. a failed authorization
+func (c *natsConn) readLoop(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			c.failed <- err
+			return
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			if err := c.write("PONG\r\n"); err != nil {
+				c.failed <- err
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			c.failed <- fmt.Errorf("server error: %s", strings.TrimPrefix(line, "-ERR "))
+			return
+		}
+	}
+}
+
+// send publishes queued results until the connection fails. A result whose write
+// failed is lost.
+func (p *natsPublisher) send(conn *natsConn) error {
+	for {
+		select {
+		case err := <-conn.failed:
+			return err
+		case data := <-p.queue:
+			if err := conn.write(fmt.Sprintf("PUB %s %d\r\n%s\r\n", p.subject, len(data), data)); err != nil {
+				return err
+			}
+		}
+	}
+}
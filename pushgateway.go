@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// pushgatewayPublisher pushes each result as a metric group to a Prometheus Pushgateway
+// (PUSHGATEWAY_URL), grouped by job, method and host so every target keeps its own values
+type pushgatewayPublisher struct {
+	url     string
+	job     string
+	client  *http.Client
+	queue   chan Response
+	dropped atomic.Int64
+}
+
+func newPushgatewayPublisher(rawURL, job string) (*pushgatewayPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("want an http(s) URL, e.g. http://pushgateway:9091")
+	}
+	if job == "" {
+		return nil, fmt.Errorf("job can't be empty")
+	}
+	p := &pushgatewayPublisher{
+		url:    strings.TrimSuffix(u.String(), "/"),
+		job:    job,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Response, publishQueueSize),
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *pushgatewayPublisher) Publish(resp Response) {
+	select {
+	case p.queue <- resp:
+	default:
+		if p.dropped.Add(1)%publishQueueSize == 1 {
+			log.Printf("WARNING: pushgateway queue full, %d results dropped so far", p.dropped.Load())
+		}
+	}
+}
+
+// run pushes queued results one by one. Failures are logged when pushing starts failing
+// and when it works again, not for every result in between.
+func (p *pushgatewayPublisher) run() {
+	failing := false
+	for resp := range p.queue {
+		err := p.push(resp)
+		switch {
+		case err != nil && !failing:
+			log.Printf("WARNING: pushgateway: push failed, results are lost until it works again: %v", err)
+		case err == nil && failing:
+			log.Printf("pushgateway: pushing works again")
+		}
+		failing = err != nil
+	}
+}
+
+// push replaces the metrics of the result's group. Label values go base64 encoded into
+// the path, hosts can contain slashes.
+func (p *pushgatewayPublisher) push(resp Response) error {
+	path := fmt.Sprintf("%s/metrics/job/%s/method/%s/host@base64/%s", p.url,
+		url.PathEscape(p.job), url.PathEscape(resp.Type), pushgatewayLabel(resp.Host))
+
+	req, err := http.NewRequest(http.MethodPut, path, bytes.NewReader(pushgatewayMetrics(resp, time.Now())))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// pushgatewayLabel encodes a grouping label value; "=" stands for the empty value
+func pushgatewayLabel(v string) string {
+	if v == "" {
+		return "="
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(v))
+}
+
+// pushgatewayMetrics renders one result in the Prometheus text format. pinger_check_result
+// is only there when the result is a plain number, e.g. a connect time or status code.
+func pushgatewayMetrics(resp Response, now time.Time) []byte {
+	var b bytes.Buffer
+	up := 0
+	if resp.Up {
+		up = 1
+	}
+	b.WriteString("# HELP pinger_check_up Whether the check succeeded.\n")
+	b.WriteString("# TYPE pinger_check_up gauge\n")
+	fmt.Fprintf(&b, "pinger_check_up %d\n", up)
+	if data, err := json.Marshal(resp.Result); err == nil {
+		if v, err := strconv.ParseFloat(string(data), 64); err == nil && resp.Error == "" {
+			b.WriteString("# HELP pinger_check_result The check's numeric result, e.g. milliseconds or an HTTP status.\n")
+			b.WriteString("# TYPE pinger_check_result gauge\n")
+			fmt.Fprintf(&b, "pinger_check_result %s\n", strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	b.WriteString("# HELP pinger_check_last_run_timestamp_seconds When the check ran.\n")
+	b.WriteString("# TYPE pinger_check_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "pinger_check_last_run_timestamp_seconds %d\n", now.Unix())
+	return b.Bytes()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const codeALPNMismatch = "ALPN_MISMATCH" // The server supports none of the offered ALPN protocols
+
+// TLS alert no_application_protocol as a QUIC transport error (RFC 9001, 4.8)
+const quicNoApplicationProtocol = 0x100 + 120
+
+// QUICResult is the result of method=quic
+type QUICResult struct {
+	HandshakeMs float64 `json:"handshake_ms"`
+	ALPN        string  `json:"alpn"`        // Protocol the server picked from the offered list
+	Version     string  `json:"version"`     // QUIC version, e.g. v1
+	TLSVersion  string  `json:"tls_version"` // Always TLS 1.3 for QUIC, reported for completeness
+}
+
+// quicChecker completes a QUIC handshake with host:port (default 443) without touching HTTP/3 itself
+type quicChecker struct{}
+
+type quicOptions struct {
+	Addr       string
+	ServerName string
+	ALPN       []string
+	Insecure   bool
+	Timeout    time.Duration
+}
+
+func parseQUICOptions(p checkParams) (quicOptions, error) {
+	host, hostPort, _ := splitTarget(strings.TrimPrefix(p.Host, "quic://"))
+	port := p.Get("port")
+	if port == "" {
+		port = hostPort
+	}
+	if port == "" {
+		port = "443"
+	}
+	opts := quicOptions{Addr: net.JoinHostPort(host, port), ServerName: host, Insecure: p.Get("insecure") == "true", ALPN: []string{"h3"}}
+
+	if list := p.Get("alpn"); list != "" {
+		opts.ALPN = nil
+		for _, proto := range strings.Split(list, ",") {
+			if proto = strings.TrimSpace(proto); proto != "" {
+				opts.ALPN = append(opts.ALPN, proto)
+			}
+		}
+		if len(opts.ALPN) == 0 {
+			return opts, paramErrorf("alpn must list at least one protocol")
+		}
+	}
+
+	timeout, _, err := p.timeouts()
+	if err != nil {
+		return opts, err
+	}
+	opts.Timeout = timeout
+	return opts, nil
+}
+
+func (quicChecker) Validate(p checkParams) error {
+	_, err := parseQUICOptions(p)
+	return err
+}
+
+func (quicChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseQUICOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	tlsConf := &tls.Config{
+		RootCAs:            trustedRoots,
+		ServerName:         opts.ServerName,
+		NextProtos:         opts.ALPN,
+		InsecureSkipVerify: opts.Insecure,
+	}
+	start := time.Now()
+	conn, err := quic.DialAddr(ctx, opts.Addr, tlsConf, &quic.Config{HandshakeIdleTimeout: opts.Timeout})
+	if err != nil {
+		return 0, quicError(err)
+	}
+	elapsed := time.Since(start)
+	defer conn.CloseWithError(0, "")
+
+	state := conn.ConnectionState()
+	return QUICResult{
+		HandshakeMs: durationMs(elapsed),
+		ALPN:        state.TLS.NegotiatedProtocol,
+		Version:     state.Version.String(),
+		TLSVersion:  tls.VersionName(state.TLS.Version),
+	}, nil
+}
+
+// quicError adds an error code: certificate problems get their CERT_* code, and as
+// UDP has no connect, any timeout means the handshake never completed
+func quicError(err error) error {
+	if ce := certError(err); ce != nil {
+		return ce
+	}
+	var te *quic.TransportError
+	if errors.As(err, &te) && te.ErrorCode == quicNoApplicationProtocol {
+		return &checkError{code: codeALPNMismatch, err: err}
+	}
+	var idle *quic.IdleTimeoutError
+	var hs *quic.HandshakeTimeoutError
+	if errors.As(err, &idle) || errors.As(err, &hs) || errors.Is(err, context.DeadlineExceeded) {
+		return &checkError{code: codeConnectTimeout, err: err}
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each client a number of requests per fixed window (RATE_LIMIT, RATE_LIMIT_WINDOW)
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	clients map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// nil when RATE_LIMIT is unset or 0
+var clientRateLimit *rateLimiter
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, clients: make(map[string]*rateWindow)}
+}
+
+// clientIP is the address the request came from. Forwarded headers aren't trusted,
+// so behind a reverse proxy all clients share the proxy's address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// take counts a request of client. It returns what's left of the window and when it resets;
+// ok is false when the client has used up its requests.
+func (l *rateLimiter) take(client string) (remaining int, reset time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w := l.clients[client]
+	if w == nil || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.clients[client] = w
+	}
+	reset = w.start.Add(l.window).Sub(now)
+	if w.count >= l.limit {
+		return 0, reset, false
+	}
+	w.count++
+	return l.limit - w.count, reset, true
+}
+
+// cleanupLoop drops clients whose window has passed
+func (l *rateLimiter) cleanupLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.cleanup()
+	}
+}
+
+func (l *rateLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-l.window)
+	for client, w := range l.clients {
+		if w.start.Before(cutoff) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// limitRate answers clients over RATE_LIMIT with 429. Every response gets the
+// X-RateLimit-* headers so clients can slow down before hitting the limit.
+func limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Probes must keep working for a busy client, e.g. a load balancer sharing an address
+		if clientRateLimit == nil || r.URL.Path == "/healthz" || r.URL.Path == "/ready" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		remaining, reset, ok := clientRateLimit.take(clientIP(r))
+		resetSeconds := strconv.Itoa(int(math.Ceil(reset.Seconds())))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(clientRateLimit.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", resetSeconds)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", resetSeconds)
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded, try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rdapBootstrapURL = "https://data.iana.org/rdap/dns.json"
+	rdapBootstrapTTL = 24 * time.Hour
+	rdapMaxBody      = 1 << 20 // RDAP responses are small, cap them at 1 MiB
+)
+
+// Days before expiry at which a domain is reported with a warning (RDAP_EXPIRY_WARN_DAYS)
+var rdapWarnDays = 30
+
+// RDAPResult is the result of method=rdap
+type RDAPResult struct {
+	Domain   string     `json:"domain"`
+	Status   []string   `json:"status"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	DaysLeft int        `json:"days_left"`
+}
+
+// rdapBootstrap caches the IANA TLD -> RDAP server mapping
+var rdapBootstrap struct {
+	mu      sync.Mutex
+	servers map[string]string
+	fetched time.Time
+}
+
+var rdapClient = &http.Client{Timeout: 5 * time.Second}
+
+// rdapChecker looks up the domain in host
+type rdapChecker struct{}
+
+func (rdapChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	return checkRDAP(ctx, p.Host)
+}
+
+func checkRDAP(ctx context.Context, host string) (any, error) {
+	domain := rdapDomain(host)
+	if !strings.Contains(domain, ".") {
+		return 0, fmt.Errorf("rdap requires a domain name")
+	}
+
+	server, err := rdapServerFor(ctx, domain)
+	if err != nil {
+		return 0, err
+	}
+
+	var data struct {
+		Status []string `json:"status"`
+		Events []struct {
+			Action string    `json:"eventAction"`
+			Date   time.Time `json:"eventDate"`
+		} `json:"events"`
+	}
+	if err := rdapGet(ctx, strings.TrimSuffix(server, "/")+"/domain/"+domain, &data); err != nil {
+		return 0, err
+	}
+
+	res := RDAPResult{Domain: domain, Status: data.Status}
+	for _, ev := range data.Events {
+		if ev.Action == "expiration" {
+			expires := ev.Date
+			res.Expires = &expires
+			break
+		}
+	}
+	if res.Expires == nil {
+		return res, nil // Some registries don't publish expiry
+	}
+
+	res.DaysLeft = int(time.Until(*res.Expires).Hours() / 24)
+	if res.DaysLeft < 0 {
+		return res, fmt.Errorf("domain expired on %s", res.Expires.Format("2006-01-02"))
+	}
+	if res.DaysLeft <= rdapWarnDays {
+		return res, warningError{fmt.Sprintf("domain expires in %d days", res.DaysLeft)}
+	}
+	return res, nil
+}
+
+// rdapDomain strips scheme, path and port so a URL-ish host becomes a bare domain
+func rdapDomain(host string) string {
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// rdapServerFor finds the RDAP base URL for the longest matching suffix of domain
+func rdapServerFor(ctx context.Context, domain string) (string, error) {
+	rdapBootstrap.mu.Lock()
+	defer rdapBootstrap.mu.Unlock()
+
+	if rdapBootstrap.servers == nil || time.Since(rdapBootstrap.fetched) > rdapBootstrapTTL {
+		var data struct {
+			Services [][][]string `json:"services"`
+		}
+		if err := rdapGet(ctx, rdapBootstrapURL, &data); err != nil {
+			// Keep serving a stale bootstrap rather than failing outright
+			if rdapBootstrap.servers == nil {
+				return "", fmt.Errorf("rdap bootstrap failed: %w", err)
+			}
+		} else {
+			servers := make(map[string]string)
+			for _, svc := range data.Services {
+				if len(svc) < 2 || len(svc[1]) == 0 {
+					continue
+				}
+				for _, tld := range svc[0] {
+					servers[strings.ToLower(tld)] = svc[1][0]
+				}
+			}
+			rdapBootstrap.servers = servers
+			rdapBootstrap.fetched = time.Now()
+		}
+	}
+
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		if server, ok := rdapBootstrap.servers[strings.Join(labels[i:], ".")]; ok {
+			return server, nil
+		}
+	}
+	return "", fmt.Errorf("no rdap server for %s", domain)
+}
+
+func rdapGet(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+
+	resp, err := rdapClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("domain not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rdap server returned %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, rdapMaxBody)).Decode(v); err != nil {
+		return fmt.Errorf("invalid rdap response: %w", err)
+	}
+	return nil
+}
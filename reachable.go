@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Port of the TCP fallback unless one is given
+const defaultReachablePort = 443
+
+// ReachableResult is the result of method=reachable
+type ReachableResult struct {
+	Via    string             `json:"via,omitempty"` // Method that got an answer, empty if none did
+	Result any                `json:"result"`        // That method's result
+	Tried  []ReachableAttempt `json:"tried"`
+}
+
+// Up when any method reached the host
+func (r ReachableResult) Up() bool { return r.Via != "" }
+
+// ReachableAttempt is one method tried by a reachable check
+type ReachableAttempt struct {
+	Method    string `json:"method"`
+	Up        bool   `json:"up"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// reachableChecker tries ping, then a TCP connect, then an HTTP HEAD, and stops at the first that works
+type reachableChecker struct{}
+
+// reachablePort is the port param, else the one in host:port, else defaultReachablePort
+func reachablePort(p checkParams) (int, error) {
+	s := p.Get("port")
+	if s == "" {
+		_, s, _ = splitTarget(p.Host)
+	}
+	if s == "" {
+		return defaultReachablePort, nil
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, paramErrorf("port must be between 1 and 65535")
+	}
+	return port, nil
+}
+
+func (reachableChecker) Validate(p checkParams) error {
+	_, err := reachablePort(p)
+	return err
+}
+
+// reachableStep is one of the checks a reachable check tries, in order
+type reachableStep struct {
+	method string
+	params checkParams
+}
+
+func reachableSteps(p checkParams, port int) []reachableStep {
+	host, _, _ := splitTarget(p.Host)
+	steps := []reachableStep{
+		{"ping", checkParams{Query: url.Values{}}},
+		{"tcp", checkParams{Query: url.Values{"port": {strconv.Itoa(port)}}}},
+		{"http", checkParams{Query: url.Values{"http_method": {"HEAD"}}}},
+	}
+	for i := range steps {
+		steps[i].params.Host = host
+		steps[i].params.Query.Set("host", host)
+		if t := p.Get("timeout"); t != "" && steps[i].method != "ping" {
+			steps[i].params.Query.Set("timeout", t) // ping's timeout is per packet
+		}
+	}
+	return steps
+}
+
+// MaxDuration lets the handler extend its write deadline: against a dead host every step runs to its end
+func (reachableChecker) MaxDuration(p checkParams) time.Duration {
+	port, err := reachablePort(p)
+	if err != nil {
+		return 0
+	}
+	var total time.Duration
+	for _, step := range reachableSteps(p, port) {
+		if methodEnabled(step.method) != nil {
+			continue
+		}
+		m, _ := lookupMethod(step.method)
+		d := checkDuration(m, step.params)
+		if d == 0 {
+			d = defaultCheckTimeout
+		}
+		total += d
+	}
+	return total
+}
+
+func (reachableChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	port, err := reachablePort(p)
+	if err != nil {
+		return 0, err
+	}
+
+	res := ReachableResult{Result: 0}
+	for _, step := range reachableSteps(p, port) {
+		attempt := ReachableAttempt{Method: step.method}
+		if err := methodEnabled(step.method); err != nil {
+			attempt.Error = err.Error()
+			res.Tried = append(res.Tried, attempt)
+			continue
+		}
+
+		m, _ := lookupMethod(step.method)
+		resp, err := runCheck(ctx, step.method, m, step.params)
+		if err != nil {
+			return 0, err
+		}
+		// Any HTTP answer proves the host is there, even an error status
+		attempt.Up = resp.Up || (step.method == "http" && resp.Error == "")
+		attempt.Error, attempt.ErrorCode = resp.Error, resp.ErrorCode
+		res.Tried = append(res.Tried, attempt)
+		if attempt.Up {
+			res.Via, res.Result = step.method, resp.Result
+			return res, nil
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisResult is the result of method=redis
+type RedisResult struct {
+	ConnectMs float64 `json:"connect_ms"`
+	PingMs    float64 `json:"ping_ms"` // From sending PING to the +PONG
+	DB        int     `json:"db"`      // Selected with db, 0 otherwise
+}
+
+// redisChecker sends PING over RESP, after AUTH and SELECT when asked to
+type redisChecker struct{}
+
+type redisOptions struct {
+	tcpOptions
+	User     string
+	Password string
+	DB       int
+}
+
+func parseRedisOptions(p checkParams) (redisOptions, error) {
+	opts := redisOptions{User: p.Get("user"), Password: p.Get("password")}
+	if opts.User != "" && opts.Password == "" {
+		return opts, paramErrorf("user needs password")
+	}
+	if s := p.Get("db"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, paramErrorf("db must be a database number, e.g. 1")
+		}
+		opts.DB = n
+	}
+
+	var err error
+	if opts.Dialer, err = p.Dialer(); err != nil {
+		return opts, err
+	}
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// redisAddress is host:port, port 6379 unless given
+func redisAddress(p checkParams) string {
+	port := p.Get("port")
+	if port == "" {
+		if _, hostPort, _ := splitTarget(p.Host); hostPort == "" {
+			port = "6379"
+		}
+	}
+	addr, _ := tcpAddress(strings.TrimPrefix(p.Host, "redis://"), port)
+	return addr
+}
+
+func (redisChecker) Validate(p checkParams) error {
+	_, err := parseRedisOptions(p)
+	return err
+}
+
+func (redisChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseRedisOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	return checkRedis(ctx, redisAddress(p), opts)
+}
+
+func checkRedis(ctx context.Context, addr string, opts redisOptions) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dialer := opts.Dialer
+	if dialer == nil {
+		dialer = directDialer
+	}
+	start := time.Now()
+	conn, err := dialTimeout(ctx, dialer, "tcp", addr, opts.ConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	res := RedisResult{ConnectMs: durationMs(time.Since(start)), DB: opts.DB}
+
+	if d, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(d)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	r := bufio.NewReader(conn)
+	if opts.Password != "" {
+		args := []string{"AUTH", opts.Password}
+		if opts.User != "" {
+			args = []string{"AUTH", opts.User, opts.Password} // Redis 6 ACL users
+		}
+		if err := redisExpect(ctx, conn, r, "OK", args...); err != nil {
+			return 0, err
+		}
+	}
+	if opts.DB != 0 {
+		if err := redisExpect(ctx, conn, r, "OK", "SELECT", strconv.Itoa(opts.DB)); err != nil {
+			return 0, err
+		}
+	}
+
+	pingStart := time.Now()
+	if err := redisExpect(ctx, conn, r, "PONG", "PING"); err != nil {
+		return 0, err
+	}
+	res.PingMs = durationMs(time.Since(pingStart))
+	return res, nil
+}
+
+// redisExpect sends a command as a RESP array and wants the simple string want back.
+// Error replies, e.g. "-NOAUTH Authentication required.", become the check's error.
+func redisExpect(ctx context.Context, conn net.Conn, r *bufio.Reader, want string, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return redisError(ctx, args[0], err)
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return redisError(ctx, args[0], err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case line == "+"+want:
+		return nil
+	case strings.HasPrefix(line, "-"):
+		return fmt.Errorf("redis %s failed: %s", args[0], line[1:])
+	}
+	if len(line) > 100 {
+		line = line[:100]
+	}
+	return fmt.Errorf("redis %s failed: unexpected reply %q, not a Redis server?", args[0], line)
+}
+
+// redisError names the command that failed; one cut off by the timeout is a READ_TIMEOUT
+func redisError(ctx context.Context, cmd string, err error) error {
+	err = fmt.Errorf("redis %s failed: %w", cmd, err)
+	if ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		return &checkError{code: codeReadTimeout, err: err}
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Shortest HSTS max-age that passes, 180 days
+const minHSTSMaxAge = 180 * 24 * 60 * 60
+
+// SecurityHeadersResult grades the security headers of a response (check_security_headers=true)
+type SecurityHeadersResult struct {
+	Grade   string                         `json:"grade"` // A when every header passed, down to F
+	Passed  int                            `json:"passed"`
+	Total   int                            `json:"total"`
+	Headers map[string]SecurityHeaderCheck `json:"headers"`
+}
+
+// SecurityHeaderCheck is the verdict on one header
+type SecurityHeaderCheck struct {
+	Present bool   `json:"present"`
+	Value   string `json:"value,omitempty"`
+	Pass    bool   `json:"pass"`
+	Reason  string `json:"reason,omitempty"` // Why it failed
+}
+
+// securityHeaderRule is a header to grade and how
+type securityHeaderRule struct {
+	name  string
+	check func(value string, h http.Header) string // Why value fails, empty when it passes
+}
+
+var securityHeaderRules = []securityHeaderRule{
+	{"Strict-Transport-Security", checkHSTS},
+	{"Content-Security-Policy", func(v string, _ http.Header) string {
+		if strings.TrimSpace(v) == "" {
+			return "missing"
+		}
+		return ""
+	}},
+	{"X-Frame-Options", func(v string, h http.Header) string {
+		switch strings.ToUpper(strings.TrimSpace(v)) {
+		case "DENY", "SAMEORIGIN":
+			return ""
+		case "":
+			// frame-ancestors in the CSP does the same job
+			if strings.Contains(h.Get("Content-Security-Policy"), "frame-ancestors") {
+				return ""
+			}
+			return "missing"
+		}
+		return "should be DENY or SAMEORIGIN"
+	}},
+	{"X-Content-Type-Options", func(v string, _ http.Header) string {
+		switch {
+		case v == "":
+			return "missing"
+		case !strings.EqualFold(strings.TrimSpace(v), "nosniff"):
+			return "should be nosniff"
+		}
+		return ""
+	}},
+	{"Referrer-Policy", func(v string, _ http.Header) string {
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "":
+			return "missing"
+		case "unsafe-url", "no-referrer-when-downgrade":
+			return "leaks the full URL to other origins"
+		}
+		return ""
+	}},
+	{"Permissions-Policy", func(v string, _ http.Header) string {
+		if strings.TrimSpace(v) == "" {
+			return "missing"
+		}
+		return ""
+	}},
+}
+
+// checkHSTS requires a max-age of at least minHSTSMaxAge
+func checkHSTS(v string, _ http.Header) string {
+	if v == "" {
+		return "missing"
+	}
+	for _, directive := range strings.Split(v, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		age, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil {
+			return "invalid max-age"
+		}
+		if age < minHSTSMaxAge {
+			return "max-age is below 180 days"
+		}
+		return ""
+	}
+	return "no max-age"
+}
+
+// auditSecurityHeaders checks the headers of a response. HSTS is only judged over
+// https, browsers ignore it on plain http.
+func auditSecurityHeaders(h http.Header, https bool) *SecurityHeadersResult {
+	res := &SecurityHeadersResult{Headers: make(map[string]SecurityHeaderCheck)}
+	for _, rule := range securityHeaderRules {
+		if rule.name == "Strict-Transport-Security" && !https {
+			continue
+		}
+		value := strings.Join(h.Values(rule.name), ", ")
+		reason := rule.check(value, h)
+		check := SecurityHeaderCheck{Present: value != "", Value: value, Pass: reason == "", Reason: reason}
+		if check.Pass {
+			res.Passed++
+		}
+		res.Total++
+		res.Headers[rule.name] = check
+	}
+	res.Grade = securityGrade(res.Passed, res.Total)
+	return res
+}
+
+// securityGrade maps the share of passed headers to a letter
+func securityGrade(passed, total int) string {
+	if total == 0 || passed == total {
+		return "A"
+	}
+	switch share := float64(passed) / float64(total); {
+	case share >= 0.8:
+		return "B"
+	case share >= 0.6:
+		return "C"
+	case share >= 0.4:
+		return "D"
+	}
+	return "F"
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Default SOCKS5 proxy for TCP/HTTP checks (SOCKS5_PROXY), overridable per request with socks5=
+var defaultSOCKS5Proxy string
+
+// contextDialer is satisfied by *net.Dialer and the SOCKS5 dialer
+type contextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// No fixed Timeout: connect deadlines come from the context (see dialTimeout)
+var directDialer = &net.Dialer{KeepAlive: 30 * time.Second}
+
+// proxyDialError means the proxy itself couldn't be reached, as opposed to the target
+type proxyDialError struct {
+	kind string // "socks5" or "http"
+	addr string
+	err  error
+}
+
+func (e *proxyDialError) Error() string {
+	return fmt.Sprintf("%s proxy %s unreachable: %v", e.kind, e.addr, e.err)
+}
+
+func (e *proxyDialError) Unwrap() error { return e.err }
+
+// proxyForwarder dials the proxy and tags failures as proxyDialError
+type proxyForwarder struct{}
+
+func (proxyForwarder) Dial(network, addr string) (net.Conn, error) {
+	return proxyForwarder{}.DialContext(context.Background(), network, addr)
+}
+
+func (proxyForwarder) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := directDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, &proxyDialError{kind: "socks5", addr: addr, err: err}
+	}
+	return conn, nil
+}
+
+// socksDialer returns a dialer that tunnels through the SOCKS5 proxy at addr
+// (host:port or socks5://[user:pass@]host:port). An empty addr means direct.
+func socksDialer(addr string) (contextDialer, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "socks5://" + addr
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme != "socks5" || u.Host == "" {
+		return nil, fmt.Errorf("invalid socks5 proxy %q", addr)
+	}
+
+	var auth *proxy.Auth
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: pass}
+	}
+
+	d, err := proxy.SOCKS5("tcp", u.Host, auth, proxyForwarder{})
+	if err != nil {
+		return nil, err
+	}
+	return d.(contextDialer), nil
+}
+
+// Dialer returns the dialer for the netns param, the HTTP CONNECT dialer for connect_proxy,
+// or the SOCKS5 dialer for the socks5 param (or SOCKS5_PROXY); nil for direct.
+// With nat64=true the direct or netns dialer goes to the target's NAT64 address.
+func (p checkParams) Dialer() (contextDialer, error) {
+	nat64 := p.Get("nat64") == "true"
+	if nat64 && (p.Get("socks5") != "" || p.Get("connect_proxy") != "") {
+		return nil, paramErrorf("nat64 can't be combined with socks5 or connect_proxy, the proxy connects to the target")
+	}
+	if name := p.Get("netns"); name != "" {
+		if p.Get("socks5") != "" || p.Get("connect_proxy") != "" {
+			return nil, paramErrorf("netns can't be combined with socks5 or connect_proxy")
+		}
+		path, err := netnsPath(name)
+		if err != nil {
+			return nil, paramError{err.Error()}
+		}
+		d, err := newNetnsDialer(path)
+		if err != nil {
+			return nil, paramError{err.Error()}
+		}
+		if nat64 {
+			return nat64Dialer{d}, nil
+		}
+		return d, nil
+	}
+	if nat64 {
+		return nat64Dialer{directDialer}, nil // Also instead of SOCKS5_PROXY
+	}
+
+	if addr := p.Get("connect_proxy"); addr != "" {
+		if p.Get("socks5") != "" {
+			return nil, paramErrorf("connect_proxy can't be combined with socks5")
+		}
+		d, err := connectDialer(addr)
+		if err != nil {
+			return nil, paramError{err.Error()}
+		}
+		return d, nil
+	}
+
+	addr := p.Get("socks5")
+	if addr == "" {
+		addr = defaultSOCKS5Proxy
+	}
+	d, err := socksDialer(addr)
+	if err != nil {
+		return nil, paramError{err.Error()}
+	}
+	return d, nil
+}
+
+// proxyError pulls a proxyDialError out of a wrapped dial error so it's reported as-is
+func proxyError(err error) error {
+	var pe *proxyDialError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Max addresses a cidr param may expand to (MAX_CIDR_HOSTS)
+var maxCIDRHosts = 64
+
+// expandCIDR lists the host addresses in prefix. For IPv4 subnets larger than /31 the
+// network and broadcast addresses are left out.
+func expandCIDR(cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr %q", cidr)
+	}
+	prefix = prefix.Masked()
+
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 30 || 1<<hostBits > maxCIDRHosts+2 {
+		return nil, fmt.Errorf("cidr %s is too large, max %d hosts", prefix, maxCIDRHosts)
+	}
+	skipEnds := prefix.Addr().Is4() && hostBits > 1
+
+	var hosts []string
+	addr := prefix.Addr()
+	for i := 0; i < 1<<hostBits; i, addr = i+1, addr.Next() {
+		if skipEnds && (i == 0 || i == 1<<hostBits-1) {
+			continue
+		}
+		hosts = append(hosts, addr.String())
+	}
+	if len(hosts) > maxCIDRHosts {
+		return nil, fmt.Errorf("cidr %s is too large, max %d hosts", prefix, maxCIDRHosts)
+	}
+	return hosts, nil
+}
+
+// handleSweep runs the requested check against every address of the cidr param
+// and answers with a map of address to response
+func handleSweep(w http.ResponseWriter, r *http.Request, query url.Values, version string) {
+	hosts, err := expandCIDR(query.Get("cidr"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	jobs, err := hostJobs(query, hosts, version, clientIP(r), "cidr")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results := make(map[string]any, len(jobs))
+	for i, resp := range runJobs(w, r, jobs) {
+		results[jobs[i].params.Host] = shapeResponse(resp, version, query.Get("fields"))
+	}
+
+	writeJSON(w, r, results)
+}
+
+// hostJobs turns the request into one job per host, dropping the param that listed the hosts
+func hostJobs(query url.Values, hosts []string, version, client string, drop ...string) ([]batchJob, error) {
+	if name := query.Get("method"); name != "" {
+		if _, ok := lookupMethod(name); !ok {
+			return nil, fmt.Errorf("unknown method %q", name)
+		}
+	}
+	method, info := resolveMethod(query.Get("method")) // handleRequest refused a disabled one
+
+	jobs := make([]batchJob, len(hosts))
+	for i, host := range hosts {
+		values := url.Values{}
+		for k, v := range query {
+			values[k] = v
+		}
+		for _, k := range drop {
+			values.Del(k)
+		}
+		values.Set("host", host)
+
+		params := checkParams{Host: host, Query: values, Client: client}
+		if err := validateCheck(info, params); err != nil {
+			return nil, err
+		}
+		jobs[i] = batchJob{method: method, info: info, params: params, fields: query.Get("fields"), version: version}
+	}
+	return jobs, nil
+}
+
+// runJobs runs the jobs in parallel, each waiting for a global slot, and returns the responses in job order
+func runJobs(w http.ResponseWriter, r *http.Request, jobs []batchJob) []Response {
+	var longest time.Duration
+	for _, job := range jobs {
+		longest = max(longest, checkDuration(job.info, job.params))
+	}
+	extendWriteDeadline(w, longest)
+
+	results := make([]Response, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job batchJob) {
+			defer wg.Done()
+			results[i] = job.run(r.Context())
+		}(i, job)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// splitTarget splits a host param into hostname, port and whatever follows the
+// authority (path and query). It understands "example.com:8080/path", bracketed
+// IPv6 with or without a port ("[2001:db8::1]:443") and bare IPv6 ("2001:db8::1"),
+// which never has a port. The hostname is returned without brackets.
+func splitTarget(target string) (host, port, rest string) {
+	authority := target
+	if i := strings.IndexAny(target, "/?#"); i >= 0 {
+		authority, rest = target[:i], target[i:]
+	}
+
+	if strings.HasPrefix(authority, "[") {
+		end := strings.Index(authority, "]")
+		if end < 0 {
+			return strings.TrimPrefix(authority, "["), "", rest
+		}
+		host = authority[1:end]
+		port = strings.TrimPrefix(authority[end+1:], ":")
+		return host, port, rest
+	}
+	if strings.Count(authority, ":") > 1 {
+		return authority, "", rest // Bare IPv6 literal
+	}
+	if h, p, err := net.SplitHostPort(authority); err == nil {
+		return h, p, rest
+	}
+	return authority, "", rest
+}
+
+// joinHostPort is net.JoinHostPort that leaves out an empty port,
+// still bracketing IPv6 addresses so the result can go into a URL
+func joinHostPort(host, port string) string {
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// targetURL builds scheme://host[:port][/path] from a host param
+func targetURL(scheme, target string) string {
+	host, port, rest := splitTarget(target)
+	return scheme + "://" + joinHostPort(host, port) + rest
+}
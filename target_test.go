@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestSplitTarget(t *testing.T) {
+	tests := []struct {
+		target, host, port, rest string
+		url                      string // targetURL("https", target)
+		tcp                      string // tcpAddress(target, ""), empty when it needs a port param
+	}{
+		{"[2001:db8::1]:443", "2001:db8::1", "443", "", "https://[2001:db8::1]:443", "[2001:db8::1]:443"},
+		{"2001:db8::1", "2001:db8::1", "", "", "https://[2001:db8::1]", ""},
+		{"[::1]/path", "::1", "", "/path", "https://[::1]/path", ""},
+		{"host:8080/path", "host", "8080", "/path", "https://host:8080/path", "host:8080"},
+		{"example.com", "example.com", "", "", "https://example.com", ""},
+	}
+	for _, tt := range tests {
+		host, port, rest := splitTarget(tt.target)
+		if host != tt.host || port != tt.port || rest != tt.rest {
+			t.Errorf("splitTarget(%q) = %q, %q, %q, want %q, %q, %q", tt.target, host, port, rest, tt.host, tt.port, tt.rest)
+		}
+		if got := targetURL("https", tt.target); got != tt.url {
+			t.Errorf("targetURL(https, %q) = %q, want %q", tt.target, got, tt.url)
+		}
+		got, err := tcpAddress(tt.target, "")
+		if tt.tcp == "" && err == nil {
+			t.Errorf("tcpAddress(%q, \"\") = %q, want a port required error", tt.target, got)
+		}
+		if tt.tcp != "" && (err != nil || got != tt.tcp) {
+			t.Errorf("tcpAddress(%q, \"\") = %q, %v, want %q", tt.target, got, err, tt.tcp)
+		}
+	}
+}
+
+func TestTCPAddressPortParam(t *testing.T) {
+	tests := []struct{ target, port, want string }{
+		{"2001:db8::1", "22", "[2001:db8::1]:22"},
+		{"[::1]/path", "22", "[::1]:22"},
+		{"[2001:db8::1]:443", "22", "[2001:db8::1]:22"}, // The port param wins
+		{"tcp://host:8080", "", "host:8080"},
+	}
+	for _, tt := range tests {
+		if got, err := tcpAddress(tt.target, tt.port); err != nil || got != tt.want {
+			t.Errorf("tcpAddress(%q, %q) = %q, %v, want %q", tt.target, tt.port, got, err, tt.want)
+		}
+	}
+}
+
+func TestJoinHostPort(t *testing.T) {
+	tests := []struct{ host, port, want string }{
+		{"2001:db8::1", "443", "[2001:db8::1]:443"},
+		{"2001:db8::1", "", "[2001:db8::1]"},
+		{"example.com", "", "example.com"},
+		{"example.com", "8080", "example.com:8080"},
+	}
+	for _, tt := range tests {
+		if got := joinHostPort(tt.host, tt.port); got != tt.want {
+			t.Errorf("joinHostPort(%q, %q) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tcpChecker connects to host:port, optionally through a proxy
+type tcpChecker struct{}
+
+func (tcpChecker) Validate(p checkParams) error {
+	if _, err := tcpAddress(p.Host, p.Get("port")); err != nil {
+		return paramError{err.Error()}
+	}
+	if _, err := tcpSamples(p); err != nil {
+		return err
+	}
+	_, err := p.Dialer()
+	return err
+}
+
+// Upper bound for samples=, connects are sequential and share one timeout
+const maxTCPSamples = 10
+
+// tcpSamples reads samples, 0 when unset
+func tcpSamples(p checkParams) (int, error) {
+	s := p.Get("samples")
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxTCPSamples {
+		return 0, paramErrorf("samples must be between 1 and %d", maxTCPSamples)
+	}
+	return n, nil
+}
+
+func (tcpChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	dialer, err := p.Dialer()
+	if err != nil {
+		return 0, err
+	}
+	timeout, connectTimeout, err := p.timeouts()
+	if err != nil {
+		return 0, err
+	}
+	samples, err := tcpSamples(p)
+	if err != nil {
+		return 0, err
+	}
+	opts := tcpOptions{
+		Dialer:         dialer,
+		ResolveTiming:  p.Get("resolve_timing") == "true",
+		Samples:        samples,
+		Timeout:        timeout,
+		ConnectTimeout: connectTimeout,
+	}
+	return checkTCP(ctx, p.Host, p.Get("port"), opts)
+}
+
+// tcpOptions controls checkTCP
+type tcpOptions struct {
+	Dialer         contextDialer // Non-nil when the check goes through a proxy
+	ResolveTiming  bool          // Resolve up front and report dns_ms
+	Samples        int           // Connect this many times and report min/avg/max (samples), 0 for a single connect
+	Timeout        time.Duration // Whole check, including DNS
+	ConnectTimeout time.Duration // The connect itself
+}
+
+// TCPResult replaces the plain connect time when resolve_timing=true or samples is set
+type TCPResult struct {
+	ConnectMs float64  `json:"connect_ms"`       // Average over the successful samples
+	DNSMs     *float64 `json:"dns_ms,omitempty"` // Omitted for IP literals and proxied checks
+
+	// With samples
+	Samples *int     `json:"samples,omitempty"`
+	Failed  *int     `json:"failed,omitempty"`
+	MinMs   *float64 `json:"min_ms,omitempty"`
+	MaxMs   *float64 `json:"max_ms,omitempty"`
+}
+
+// checkTCP connects to host:port and returns the connect time in milliseconds.
+// With ResolveTiming the name is resolved up front so DNS time isn't counted as connect time.
+func checkTCP(ctx context.Context, host, port string, opts tcpOptions) (any, error) {
+	addr, err := tcpAddress(host, port)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dialer := opts.Dialer
+	var dnsMs *float64
+	if dialer == nil {
+		dialer = directDialer
+		if opts.ResolveTiming {
+			if addr, dnsMs, err = resolveAddr(ctx, addr); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if opts.Samples > 0 {
+		res, err := sampleTCP(ctx, dialer, addr, opts)
+		var partial partialError
+		if err != nil && !errors.As(err, &partial) {
+			return 0, err
+		}
+		res.DNSMs = dnsMs
+		return res, err
+	}
+
+	elapsed, err := connectTCP(ctx, dialer, addr, opts.ConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+
+	if !opts.ResolveTiming {
+		return durationMs(elapsed), nil
+	}
+	return TCPResult{ConnectMs: durationMs(elapsed), DNSMs: dnsMs}, nil
+}
+
+// connectTCP opens and immediately closes one connection, returning the connect time
+func connectTCP(ctx context.Context, d contextDialer, addr string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	conn, err := dialTimeout(ctx, d, "tcp", addr, timeout)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+	return elapsed, nil
+}
+
+// sampleTCP connects opts.Samples times in a row. Failed connects are counted, the
+// check only fails if none succeeded. Samples not started before the deadline count as
+// failed, and the result comes with a partialError.
+func sampleTCP(ctx context.Context, d contextDialer, addr string, opts tcpOptions) (TCPResult, error) {
+	var ok []time.Duration
+	var lastErr error
+	attempted := 0
+	for ; attempted < opts.Samples && ctx.Err() == nil; attempted++ {
+		elapsed, err := connectTCP(ctx, d, addr, opts.ConnectTimeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ok = append(ok, elapsed)
+	}
+	if len(ok) == 0 {
+		if lastErr == nil {
+			lastErr = ctx.Err()
+		}
+		return TCPResult{}, lastErr
+	}
+
+	minD, maxD, total := ok[0], ok[0], time.Duration(0)
+	for _, e := range ok {
+		minD, maxD, total = min(minD, e), max(maxD, e), total+e
+	}
+	samples, failed := opts.Samples, opts.Samples-len(ok)
+	minMs, maxMs := durationMs(minD), durationMs(maxD)
+	res := TCPResult{
+		ConnectMs: durationMs(total / time.Duration(len(ok))),
+		Samples:   &samples,
+		Failed:    &failed,
+		MinMs:     &minMs,
+		MaxMs:     &maxMs,
+	}
+	if attempted < opts.Samples {
+		return res, partialError{&checkError{code: codeTimeout, err: fmt.Errorf("timeout after %d of %d samples", attempted, opts.Samples)}}
+	}
+	return res, nil
+}
+
+// dialTimeout dials with its own deadline so a slow connect is reported as CONNECT_TIMEOUT,
+// separately from a connection that was made but then didn't answer in time
+func dialTimeout(ctx context.Context, d contextDialer, network, addr string, timeout time.Duration) (net.Conn, error) {
+	dctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := d.DialContext(dctx, network, addr)
+	if err != nil {
+		if errors.Is(dctx.Err(), context.DeadlineExceeded) {
+			return nil, &checkError{code: codeConnectTimeout, err: fmt.Errorf("connect timeout: %w", proxyError(err))}
+		}
+		return nil, proxyError(err)
+	}
+	return conn, nil
+}
+
+// resolveAddr swaps the host in addr for its first IP and reports how long the lookup took.
+// IP literals are returned unchanged with a nil duration.
+func resolveAddr(ctx context.Context, addr string) (string, *float64, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil, nil
+	}
+
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", nil, fmt.Errorf("dns lookup failed: %w", err)
+	}
+	dns := durationMs(time.Since(start))
+	return net.JoinHostPort(ips[0].IP.String(), port), &dns, nil
+}
+
+// tcpAddress accepts "host:port", "[2001:db8::1]:port" or a bare host plus the port param
+func tcpAddress(host, port string) (string, error) {
+	host, hostPort, _ := splitTarget(strings.TrimPrefix(host, "tcp://"))
+	if port == "" {
+		port = hostPort
+	}
+	if port == "" {
+		return "", fmt.Errorf("port required")
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func tcpInfoUsable() error { return nil }
+
+// readTCPInfo asks the kernel for the TCP_INFO of the socket under conn
+func readTCPInfo(conn net.Conn) (*TCPInfoResult, error) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf("connection %T has no socket", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var info *unix.TCPInfo
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		info, serr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil {
+		return nil, err
+	}
+	if serr != nil {
+		return nil, serr
+	}
+
+	// The kernel reports times in microseconds; fields it's too old to know stay 0
+	us := func(v uint32) float64 { return float64(v) / 1000 }
+	return &TCPInfoResult{
+		RTTMs:        us(info.Rtt),
+		RTTVarMs:     us(info.Rttvar),
+		MinRTTMs:     us(info.Min_rtt),
+		Retransmits:  info.Total_retrans,
+		BytesRetrans: info.Bytes_retrans,
+		OutOfOrder:   info.Rcv_ooopack,
+		SegsIn:       info.Segs_in,
+		SegsOut:      info.Segs_out,
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+var errTCPInfoUnsupported = errors.New("tcp_info is only supported on Linux")
+
+func tcpInfoUsable() error { return errTCPInfoUnsupported }
+
+func readTCPInfo(net.Conn) (*TCPInfoResult, error) { return nil, errTCPInfoUnsupported }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// checkThrottle enforces MIN_CHECK_INTERVAL: a check (its sinceKey: method, host and the
+// params that define it) is probed at most once per interval, other requests get the last
+// result instead
+type checkThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	checks   map[string]*throttledCheck
+}
+
+type throttledCheck struct {
+	started time.Time
+	last    *Response // nil until the first check has finished
+}
+
+// nil when MIN_CHECK_INTERVAL is unset or 0
+var minCheckInterval *checkThrottle
+
+func newCheckThrottle(interval time.Duration) *checkThrottle {
+	return &checkThrottle{interval: interval, checks: make(map[string]*throttledCheck)}
+}
+
+// begin decides whether key may be probed now. If not, it returns the last result, or
+// nil (with the time left) when the only recent check is still running.
+func (t *checkThrottle) begin(key string) (cached *Response, wait time.Duration, run bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	c := t.checks[key]
+	if c != nil && now.Sub(c.started) < t.interval {
+		if c.last == nil {
+			return nil, t.interval - now.Sub(c.started), false
+		}
+		resp := *c.last
+		resp.Changed, resp.Changes = nil, nil // since is answered per request
+		return &resp, 0, false
+	}
+	if c == nil {
+		c = &throttledCheck{}
+		t.checks[key] = c
+	}
+	c.started = now
+	return nil, 0, true
+}
+
+// finish stores the result of a check started by begin. A nil resp means the check
+// didn't actually run (invalid params), so the interval isn't charged.
+func (t *checkThrottle) finish(key string, resp *Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.checks[key]
+	if c == nil {
+		return
+	}
+	if resp == nil {
+		c.started = time.Time{}
+		return
+	}
+	c.last = resp
+}
+
+// cleanupLoop drops entries whose interval has passed, like hostLimiter.cleanupLoop
+func (t *checkThrottle) cleanupLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.cleanup()
+	}
+}
+
+func (t *checkThrottle) cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-t.interval)
+	for key, c := range t.checks {
+		if c.started.Before(cutoff) {
+			delete(t.checks, key)
+		}
+	}
+}
+
+// runThrottled is runCheck behind MIN_CHECK_INTERVAL. Recent results are returned with
+// Cached set; wait > 0 means the target is being checked right now and there's nothing to return yet.
+func runThrottled(ctx context.Context, method string, m methodInfo, params checkParams) (resp Response, wait time.Duration, err error) {
+	prev, err := parseSince(params)
+	if err != nil {
+		return Response{}, 0, err
+	}
+	if on, _ := maintenance.active(time.Now()); on {
+		// Nothing is probed, published or remembered for since=last
+		if err := validateCheck(m, params); err != nil {
+			return Response{}, 0, err
+		}
+		return maintenanceResponse(method, params, time.Now()), 0, nil
+	}
+	defer func() {
+		// Every check that ran goes to the broker, cached answers were published when they ran
+		if err == nil && wait == 0 && !resp.Cached {
+			resultPublisher.Publish(resp)
+		}
+	}()
+	defer func() {
+		if err == nil && wait == 0 {
+			applySince(method, params, prev, &resp)
+		}
+	}()
+
+	if minCheckInterval == nil {
+		resp, err = runCheck(ctx, method, m, params)
+		return resp, 0, err
+	}
+
+	// Invalid params are still reported as such, not hidden behind a cached result
+	if err := validateCheck(m, params); err != nil {
+		return Response{}, 0, err
+	}
+
+	key := sinceKey(method, params)
+	cached, wait, run := minCheckInterval.begin(key)
+	if !run {
+		if cached == nil {
+			return Response{}, wait, nil
+		}
+		cached.Cached = true
+		cached.CorrelationID = params.correlationID() // The stored one belongs to whoever ran the check
+		loc, _ := params.location()                   // Validated above
+		stampResponse(cached, loc)
+		cached.precision, _ = params.precision()
+		return *cached, 0, nil
+	}
+
+	resp, err = runCheck(ctx, method, m, params)
+	if err != nil {
+		minCheckInterval.finish(key, nil)
+		return resp, 0, err
+	}
+	stored := resp // applySince sets Changed and Changes on resp for this client only
+	minCheckInterval.finish(key, &stored)
+	return resp, 0, nil
+}
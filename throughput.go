@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most a throughput check may download (MAX_THROUGHPUT_BYTES)
+var maxThroughputBytes int64 = 10 << 20
+
+// ThroughputResult is the outcome of method=throughput
+type ThroughputResult struct {
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"` // From the response headers to the last byte read
+	Mbps       float64 `json:"mbps"`
+	Complete   bool    `json:"complete"` // Whole body read, false if stopped by max_bytes or the timeout
+
+	TCPInfo *TCPInfoResult `json:"tcp_info,omitempty"` // With tcp_info=true
+
+	proto string
+}
+
+// TCPInfoResult is what the kernel knows about the connection after the transfer (tcp_info=true).
+// Retransmits count our own segments; loss on the way to us shows as out-of-order packets.
+type TCPInfoResult struct {
+	RTTMs        float64 `json:"rtt_ms"` // Smoothed RTT
+	RTTVarMs     float64 `json:"rttvar_ms"`
+	MinRTTMs     float64 `json:"min_rtt_ms"`
+	Retransmits  uint32  `json:"retransmits"`
+	BytesRetrans uint64  `json:"bytes_retrans"`
+	OutOfOrder   uint32  `json:"out_of_order_packets"`
+	SegsIn       uint32  `json:"segs_in"`
+	SegsOut      uint32  `json:"segs_out"`
+}
+
+func (r ThroughputResult) Up() bool      { return httpStatus(r.Status).Up() }
+func (r ThroughputResult) Proto() string { return r.proto }
+
+// throughputChecker downloads a URL and measures the transfer rate
+type throughputChecker struct{}
+
+func (throughputChecker) Validate(p checkParams) error {
+	_, _, err := parseThroughputOptions(p)
+	return err
+}
+
+func parseThroughputOptions(p checkParams) (httpOptions, int64, error) {
+	opts := httpOptions{Method: "GET", KeepAlive: true, Insecure: p.Get("insecure") == "true"}
+	if p.Get("tcp_info") == "true" {
+		if err := tcpInfoUsable(); err != nil {
+			return opts, 0, paramError{err.Error()}
+		}
+		opts.TCPInfo = true
+	}
+
+	limit := maxThroughputBytes
+	if s := p.Get("max_bytes"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 1 || n > maxThroughputBytes {
+			return opts, 0, paramErrorf("max_bytes must be between 1 and %d", maxThroughputBytes)
+		}
+		limit = n
+	}
+
+	var err error
+	if opts.Dialer, err = p.Dialer(); err != nil {
+		return opts, 0, err
+	}
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, 0, err
+	}
+	return opts, limit, nil
+}
+
+func (throughputChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, limit, err := parseThroughputOptions(p)
+	if err != nil {
+		return 0, err
+	}
+
+	target := p.Host
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = targetURL("https", target)
+	}
+	return checkThroughput(ctx, target, limit, opts)
+}
+
+// checkThroughput streams up to limit bytes of url into io.Discard. Hitting the
+// timeout mid-body isn't an error, the rate is measured over what arrived.
+func checkThroughput(ctx context.Context, url string, limit int64, opts httpOptions) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, connectTimeoutKey{}, opts.ConnectTimeout)
+	timing := &httpTiming{}
+	ctx = httptrace.WithClientTrace(ctx, timing.trace())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, paramErrorf("invalid url %q", url)
+	}
+	// Measure the bytes on the wire, not a transparently decompressed body
+	req.Header.Set("Accept-Encoding", "identity")
+
+	client, done := checkClient(opts)
+	defer done()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, classifyHTTPError(err, timing.gotConn())
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = io.LimitReader(resp.Body, limit)
+	var info *tcpInfoReader
+	if opts.TCPInfo {
+		info = &tcpInfoReader{r: body, conn: timing.conn()}
+		if info.conn == nil {
+			info.err = errors.New("no connection to read TCP_INFO from")
+		}
+		body = info
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, body)
+	elapsed := time.Since(start)
+	if err != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return 0, fmt.Errorf("download failed after %d bytes: %v", n, err)
+	}
+
+	res := ThroughputResult{
+		Status:     resp.StatusCode,
+		proto:      resp.Proto,
+		Bytes:      n,
+		DurationMs: durationMs(elapsed),
+		Complete:   err == nil && n < limit,
+	}
+	if elapsed > 0 {
+		res.Mbps = math.Round(float64(n)*8/elapsed.Seconds()/1e4) / 100
+	}
+	if info != nil {
+		if info.last == nil {
+			if info.err == nil {
+				info.err = errors.New("the body was empty") // Snapshots are taken after reads
+			}
+			return res, warningError{fmt.Sprintf("tcp_info unavailable: %v", info.err)}
+		}
+		res.TCPInfo = info.last
+	}
+	return res, nil
+}
+
+// tcpInfoReader takes a TCP_INFO snapshot after every read of the body, so the last one
+// is there even when the server closes the connection right after the final byte
+type tcpInfoReader struct {
+	r    io.Reader
+	conn net.Conn
+	last *TCPInfoResult
+	err  error
+}
+
+func (t *tcpInfoReader) Read(b []byte) (int, error) {
+	n, err := t.r.Read(b)
+	if n > 0 && t.conn != nil {
+		if info, ierr := readTCPInfo(t.conn); ierr == nil {
+			t.last = info
+		} else {
+			t.err = ierr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Certificate problems reported in Response.ErrorCode
+const (
+	codeCertExpired          = "CERT_EXPIRED"
+	codeCertNotYetValid      = "CERT_NOT_YET_VALID"
+	codeCertUntrusted        = "CERT_UNTRUSTED" // Self-signed or issued by an unknown CA
+	codeCertHostnameMismatch = "CERT_HOSTNAME_MISMATCH"
+	codeCertInvalid          = "CERT_INVALID"
+)
+
+// Roots for verifying HTTPS checks: the system pool plus CA_BUNDLE_FILE, nil for just the system pool
+var trustedRoots *x509.CertPool
+
+// loadCABundle returns the system roots with the PEM certificates from path added
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// useCABundle makes HTTPS checks trust the certificates in path as well
+func useCABundle(path string) error {
+	pool, err := loadCABundle(path)
+	if err != nil {
+		return err
+	}
+	trustedRoots = pool
+	httpTransport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return nil
+}
+
+// verifyPeerCert checks the server certificate the way the TLS handshake would have
+// without InsecureSkipVerify. Used by require_valid_cert=true together with insecure=true.
+func verifyPeerCert(state *tls.ConnectionState, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return &checkError{code: codeCertInvalid, err: errors.New("server sent no certificate")}
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         trustedRoots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := state.PeerCertificates[0].Verify(opts); err != nil {
+		if ce := certError(err); ce != nil {
+			return ce
+		}
+		return &checkError{code: codeCertInvalid, err: err}
+	}
+	return nil
+}
+
+// certError wraps a certificate verification error with its error code, or returns nil
+// if err isn't one
+func certError(err error) *checkError {
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+
+	switch {
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		if invalid.Cert != nil && time.Now().Before(invalid.Cert.NotBefore) {
+			msg := fmt.Sprintf("certificate not valid before %s", invalid.Cert.NotBefore.Format(time.RFC3339))
+			return &checkError{code: codeCertNotYetValid, err: &rewordedError{msg: msg, cause: err}}
+		}
+		if invalid.Cert != nil {
+			msg := fmt.Sprintf("certificate expired on %s", invalid.Cert.NotAfter.Format(time.RFC3339))
+			return &checkError{code: codeCertExpired, err: &rewordedError{msg: msg, cause: err}}
+		}
+		return &checkError{code: codeCertExpired, err: err}
+	case errors.As(err, &invalid):
+		return &checkError{code: codeCertInvalid, err: err}
+	case errors.As(err, &unknown):
+		return &checkError{code: codeCertUntrusted, err: err}
+	case errors.As(err, &hostname):
+		return &checkError{code: codeCertHostnameMismatch, err: err}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Response schema versions, oldest first:
+//
+//	1: host, type, result, error (the original format)
+//	2: adds up, error_code, warning and cached
+//
+// A version's fields are never renamed, removed or given another meaning; new fields may
+// be added to the latest one (proto, partial, timestamp, ...). Anything else needs a new version.
+var apiVersions = []string{"1", "2"}
+
+// Version used when the client doesn't ask for one (API_VERSION)
+var defaultAPIVersion = "2"
+
+// responseV1 is the original response format
+type responseV1 struct {
+	Host   string `json:"host"`
+	Type   string `json:"type"`
+	Result any    `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+func knownAPIVersion(v string) bool {
+	for _, known := range apiVersions {
+		if v == known {
+			return true
+		}
+	}
+	return false
+}
+
+// requestAPIVersion picks the version from the X-API-Version header or the v param.
+// Unknown versions are answered with a 400 listing the supported ones; ok is false then.
+func requestAPIVersion(w http.ResponseWriter, r *http.Request) (version string, ok bool) {
+	version = r.Header.Get("X-API-Version")
+	if version == "" {
+		version = r.URL.Query().Get("v")
+	}
+	if version == "" {
+		version = defaultAPIVersion
+	}
+	if !knownAPIVersion(version) {
+		w.WriteHeader(http.StatusBadRequest)
+		body := map[string]any{"error": fmt.Sprintf("unsupported API version %q", version), "supported": apiVersions}
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			log.Printf("Failed to write error response: %v", err)
+		}
+		return "", false
+	}
+	w.Header().Set("X-API-Version", version)
+	return version, true
+}
+
+// versioned converts resp to the schema of the given version
+func versioned(resp Response, version string) any {
+	if version == "1" {
+		return responseV1{Host: resp.Host, Type: resp.Type, Result: roundedResult{resp.Result, resp.precision}, Error: resp.Error}
+	}
+	return resp
+}
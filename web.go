@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WebProbe is one scheme's part of a WebResult
+type WebProbe struct {
+	Status   int    `json:"status"`
+	Location string `json:"location,omitempty"` // Redirect target, if any
+	Proto    string `json:"proto,omitempty"`    // e.g. HTTP/2.0
+	Error    string `json:"error,omitempty"`
+}
+
+// WebResult is the result of method=web
+type WebResult struct {
+	HTTP             WebProbe `json:"http"`
+	HTTPS            WebProbe `json:"https"`
+	RedirectsToHTTPS bool     `json:"redirects_to_https"`
+}
+
+// Up requires a working HTTPS site; plain HTTP is informational
+func (r WebResult) Up() bool { return httpStatus(r.HTTPS.Status).Up() }
+
+// Doesn't follow redirects so the http:// probe shows where it sends visitors
+var noRedirectClient = &http.Client{
+	Timeout:   httpClient.Timeout,
+	Transport: httpTransport,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// webChecker probes http:// and https:// in parallel
+type webChecker struct{}
+
+func (webChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	host := strings.TrimPrefix(p.Host, "http://")
+	host = strings.TrimPrefix(host, "https://")
+
+	var res WebResult
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		res.HTTP = webProbe(ctx, noRedirectClient, targetURL("http", host))
+	}()
+	go func() {
+		defer wg.Done()
+		res.HTTPS = webProbe(ctx, httpClient, targetURL("https", host))
+	}()
+	wg.Wait()
+
+	if loc, err := url.Parse(res.HTTP.Location); err == nil && loc.Scheme == "https" {
+		res.RedirectsToHTTPS = res.HTTP.Status >= 300 && res.HTTP.Status < 400
+	}
+
+	// A single failing scheme shows up in its probe (and in up), only a total failure is an error
+	if res.HTTP.Error != "" && res.HTTPS.Error != "" {
+		return 0, fmt.Errorf("http: %s; https: %s", res.HTTP.Error, res.HTTPS.Error)
+	}
+	return res, nil
+}
+
+func webProbe(ctx context.Context, client *http.Client, target string) WebProbe {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", target, nil)
+	if err != nil {
+		return WebProbe{Error: err.Error()}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return WebProbe{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	return WebProbe{Status: resp.StatusCode, Location: resp.Header.Get("Location"), Proto: resp.Proto}
+}
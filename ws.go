@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsOptions controls checkWS
+type wsOptions struct {
+	URL            string
+	Header         http.Header
+	Ping           bool          // Send a ping frame and wait for the pong (ping=true)
+	Dialer         contextDialer // Non-nil when the check goes through a proxy
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+}
+
+// WSResult replaces the plain handshake time when ping=true
+type WSResult struct {
+	HandshakeMs float64 `json:"handshake_ms"`
+	PongMs      float64 `json:"pong_ms"`
+}
+
+// wsChecker opens a WebSocket connection to ws://host or wss://host
+type wsChecker struct{}
+
+func (wsChecker) Validate(p checkParams) error {
+	_, err := parseWSOptions(p)
+	return err
+}
+
+func (wsChecker) Check(ctx context.Context, p checkParams) (any, error) {
+	opts, err := parseWSOptions(p)
+	if err != nil {
+		return 0, err
+	}
+	return checkWS(ctx, opts)
+}
+
+// parseWSOptions builds the URL (ws:// unless host starts with wss://) and reads
+// the repeatable header param, each formatted as "Name: value"
+func parseWSOptions(p checkParams) (wsOptions, error) {
+	opts := wsOptions{
+		Header: http.Header{},
+		Ping:   p.Get("ping") == "true",
+	}
+
+	scheme, target := "ws", p.Host
+	if rest, ok := strings.CutPrefix(target, "wss://"); ok {
+		scheme, target = "wss", rest
+	} else {
+		target = strings.TrimPrefix(target, "ws://")
+	}
+	u, err := url.Parse(targetURL(scheme, target))
+	if err != nil || u.Host == "" {
+		return opts, paramErrorf("invalid websocket address %q", p.Host)
+	}
+	opts.URL = u.String()
+
+	for _, h := range p.Query["header"] {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return opts, paramErrorf("header must be formatted as \"Name: value\", got %q", h)
+		}
+		opts.Header.Add(name, strings.TrimSpace(value))
+	}
+
+	if opts.Dialer, err = p.Dialer(); err != nil {
+		return opts, err
+	}
+	if opts.Timeout, opts.ConnectTimeout, err = p.timeouts(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// checkWS performs the handshake and returns its duration in milliseconds.
+// With Ping it also measures the ping/pong round trip.
+func checkWS(ctx context.Context, opts wsOptions) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, connectTimeoutKey{}, opts.ConnectTimeout)
+	timing := &httpTiming{}
+	ctx = httptrace.WithClientTrace(ctx, timing.trace())
+
+	d := opts.Dialer
+	if d == nil {
+		d = directDialer
+	}
+	dialer := websocket.Dialer{
+		NetDialContext:  transportDial(d),
+		TLSClientConfig: &tls.Config{RootCAs: trustedRoots},
+	}
+
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(ctx, opts.URL, opts.Header)
+	if err != nil {
+		if resp != nil {
+			return 0, fmt.Errorf("websocket handshake failed: HTTP %d", resp.StatusCode)
+		}
+		return 0, classifyHTTPError(err, timing.gotConn())
+	}
+	defer conn.Close()
+	handshake := time.Since(start)
+
+	if !opts.Ping {
+		return durationMs(handshake), nil
+	}
+
+	deadline, _ := ctx.Deadline()
+	pong := make(chan struct{}, 1)
+	conn.SetPongHandler(func(string) error {
+		select {
+		case pong <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	// Control frames are only handled while reading, so keep a reader running
+	readErr := make(chan error, 1)
+	go func() {
+		conn.SetReadDeadline(deadline)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	pingStart := time.Now()
+	if err := conn.WriteControl(websocket.PingMessage, []byte("pinger"), deadline); err != nil {
+		return 0, fmt.Errorf("websocket ping failed: %v", err)
+	}
+
+	select {
+	case <-pong:
+		return WSResult{HandshakeMs: durationMs(handshake), PongMs: durationMs(time.Since(pingStart))}, nil
+	case err := <-readErr:
+		return 0, classifyHTTPError(fmt.Errorf("no pong received: %w", err), true)
+	case <-ctx.Done():
+		return 0, &checkError{code: codeReadTimeout, err: fmt.Errorf("no pong received: %v", ctx.Err())}
+	}
+}